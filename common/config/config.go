@@ -15,12 +15,19 @@ var (
 )
 
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Database DatabaseConfig `yaml:"database"`
-	JWT      JWTConfig      `yaml:"jwt"`
-	File     FileConfig     `yaml:"file"`
-	Redis    RedisConfig    `yaml:"redis"`
-	Log      struct {
+	Server       ServerConfig       `yaml:"server"`
+	Database     DatabaseConfig     `yaml:"database"`
+	JWT          JWTConfig          `yaml:"jwt"`
+	File         FileConfig         `yaml:"file"`
+	Redis        RedisConfig        `yaml:"redis"`
+	Password     PasswordConfig     `yaml:"password"`
+	Mail         MailConfig         `yaml:"mail"`
+	Auth         AuthConfig         `yaml:"auth"`
+	OperationLog OperationLogConfig `yaml:"operation_log"`
+	WebSocket    WebSocketConfig    `yaml:"websocket"`
+	Agent        AgentConfig        `yaml:"agent"`
+	Client       ClientConfig       `yaml:"client"`
+	Log          struct {
 		Level string `yaml:"level"`
 	} `yaml:"log"`
 }
@@ -30,6 +37,8 @@ type ServerConfig struct {
 	Port         string `yaml:"port"`
 	ReadTimeout  int    `yaml:"read_timeout"`
 	WriteTimeout int    `yaml:"write_timeout"`
+	// Debug 开启后注册无需认证即可签发管理员令牌的调试接口，仅用于开发环境
+	Debug bool `yaml:"debug"`
 }
 
 type DatabaseConfig struct {
@@ -42,9 +51,21 @@ type DatabaseConfig struct {
 }
 
 type JWTConfig struct {
-	SecretKey       string `yaml:"secret_key"`
+	SecretKey       string `yaml:"secret_key"` // 仅用于HS256
 	AccessTokenExp  int    `yaml:"access_token_exp"`
 	RefreshTokenExp int    `yaml:"refresh_token_exp"`
+	// Algorithm 签名算法：HS256（默认）、RS256、ES256、EdDSA
+	Algorithm string `yaml:"algorithm"`
+	// ActiveKid 当前用于签名的密钥，其他密钥只用于验证轮换前签发的令牌
+	ActiveKid string         `yaml:"active_kid"`
+	Keys      []JWTKeyConfig `yaml:"keys"`
+}
+
+// JWTKeyConfig JWT签名密钥，已停用的密钥可以只配置公钥
+type JWTKeyConfig struct {
+	Kid            string `yaml:"kid"`
+	PrivateKeyFile string `yaml:"private_key_file"`
+	PublicKeyFile  string `yaml:"public_key_file"`
 }
 
 type FileConfig struct {
@@ -61,8 +82,117 @@ type RedisConfig struct {
 	DB       int    `yaml:"db"`
 }
 
+// PasswordConfig 密码策略配置
+type PasswordConfig struct {
+	MinLength      int  `yaml:"min_length"`
+	RequireUpper   bool `yaml:"require_upper"`
+	RequireLower   bool `yaml:"require_lower"`
+	RequireDigit   bool `yaml:"require_digit"`
+	RequireSpecial bool `yaml:"require_special"`
+	HistoryCount   int  `yaml:"history_count"`   // 禁止重复使用最近N次的密码
+	ResetTokenExp  int  `yaml:"reset_token_exp"` // 重置链接有效期（分钟）
+}
+
+// MailConfig 邮件发送配置
+type MailConfig struct {
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+	ResetURL string `yaml:"reset_url"` // 前端重置密码页面地址
+}
+
+// AuthConfig 登录认证配置
+type AuthConfig struct {
+	// Providers 认证器链，按顺序尝试，可选 local、ldap，为空时只使用local
+	Providers []string   `yaml:"providers"`
+	LDAP      LDAPConfig `yaml:"ldap"`
+	OIDC      OIDCConfig `yaml:"oidc"`
+}
+
+// LDAPConfig LDAP/Active Directory认证配置
+type LDAPConfig struct {
+	URL                string `yaml:"url"` // 例如 ldap://ldap.example.com:389 或 ldaps://...
+	StartTLS           bool   `yaml:"start_tls"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	Timeout            int    `yaml:"timeout"` // 连接超时（秒）
+	BindDN             string `yaml:"bind_dn"` // 用于查找用户的服务账号，为空时匿名查询
+	BindPassword       string `yaml:"bind_password"`
+	BaseDN             string `yaml:"base_dn"`
+	UserFilter         string `yaml:"user_filter"` // %s 会被替换为转义后的用户名，例如 (uid=%s)
+	EmailAttr          string `yaml:"email_attr"`
+	FullNameAttr       string `yaml:"full_name_attr"`
+	GroupBaseDN        string `yaml:"group_base_dn"`
+	GroupFilter        string `yaml:"group_filter"` // %s 会被替换为转义后的用户DN，例如 (member=%s)
+	GroupNameAttr      string `yaml:"group_name_attr"`
+	// GroupRoles 按顺序匹配，用户属于多个组时取第一个匹配的角色
+	GroupRoles  []GroupRoleMapping `yaml:"group_roles"`
+	DefaultRole string             `yaml:"default_role"`
+}
+
+// OIDCConfig OpenID Connect单点登录配置
+type OIDCConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	IssuerURL    string   `yaml:"issuer_url"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"` // 本服务的回调地址 /api/auth/oidc/callback
+	Scopes       []string `yaml:"scopes"`
+	// FrontendURL 登录成功后携带令牌跳转的前端地址，为空时直接返回JSON
+	FrontendURL   string `yaml:"frontend_url"`
+	UsernameClaim string `yaml:"username_claim"`
+	EmailClaim    string `yaml:"email_claim"`
+	NameClaim     string `yaml:"name_claim"`
+	GroupsClaim   string `yaml:"groups_claim"`
+	// GroupRoles 按顺序匹配，用户属于多个组时取第一个匹配的角色
+	GroupRoles  []GroupRoleMapping `yaml:"group_roles"`
+	DefaultRole string             `yaml:"default_role"`
+}
+
+// GroupRoleMapping 外部目录组与系统角色的映射
+type GroupRoleMapping struct {
+	Group string `yaml:"group"`
+	Role  string `yaml:"role"`
+}
+
+// OperationLogConfig 操作日志异步批量写入配置
+type OperationLogConfig struct {
+	BufferSize         int    `yaml:"buffer_size"`         // 待写入队列长度，队列满时丢弃并记录警告
+	BatchSize          int    `yaml:"batch_size"`          // 每批写入条数
+	FlushInterval      int    `yaml:"flush_interval"`      // 最长写入间隔（秒）
+	MaxBodySize        int    `yaml:"max_body_size"`       // 记录的请求体最大字节数
+	CheckpointInterval int    `yaml:"checkpoint_interval"` // 哈希链签名检查点的创建间隔（分钟）
+	RetentionDays      int    `yaml:"retention_days"`      // 保留天数，超过的日志归档后删除，0表示永久保留
+	ArchiveDir         string `yaml:"archive_dir"`         // 归档文件目录
+}
+
+// WebSocketConfig WebSocket连接配置
+type WebSocketConfig struct {
+	AllowedOrigins     []string `yaml:"allowed_origins"`      // 允许建立连接的来源，为空时只允许同源，"*"表示不限制
+	SendQueueSize      int      `yaml:"send_queue_size"`      // 每个连接的发送队列长度
+	SlowConsumerPolicy string   `yaml:"slow_consumer_policy"` // 发送队列满时的处理方式：drop_oldest、coalesce、disconnect
+	PingInterval       int      `yaml:"ping_interval"`        // 发送ping的间隔（秒），需小于pong_timeout
+	PongTimeout        int      `yaml:"pong_timeout"`         // 超过该时间未收到pong则断开连接（秒）
+	Broker             string   `yaml:"broker"`               // 消息代理：memory（单实例）、redis（多实例，使用redis配置）
+	BrokerChannel      string   `yaml:"broker_channel"`       // Redis发布订阅频道
+}
+
+// AgentConfig 客户端代理配置
+type AgentConfig struct {
+	HeartbeatRetentionDays   int `yaml:"heartbeat_retention_days"`   // 心跳历史保留天数，0表示不清理
+	PerformanceRetentionDays int `yaml:"performance_retention_days"` // 心跳生成的性能数据保留天数，0表示不清理
+	DegradedAfter            int `yaml:"degraded_after"`             // 超过该时间（秒）未收到心跳，机器状态变为degraded
+	OfflineAfter             int `yaml:"offline_after"`              // 超过该时间（秒）未收到心跳，机器状态变为offline
+	TaskTimeout              int `yaml:"task_timeout"`               // 任务未指定超时时间时的默认值（秒）
+	TasksPerHeartbeat        int `yaml:"tasks_per_heartbeat"`        // 每次心跳响应最多下发的任务数
+}
+
+// ClientConfig 客户端接入配置
 type ClientConfig struct {
-	EncryptKey string `yaml:"encrypt_key"`
+	EncryptKey        string `yaml:"encrypt_key"`         // 注册密钥，用于签名注册请求并加密保存代理密钥，为空或短于16个字符时禁止注册
+	SignatureWindow   int    `yaml:"signature_window"`    // 签名时间戳允许的偏差（秒），窗口内的nonce不能重复使用
+	SecretGracePeriod int    `yaml:"secret_grace_period"` // 轮换密钥后旧密钥继续有效的时间（秒）
 }
 
 func LoadConfig() (*Config, error) {
@@ -90,6 +220,11 @@ func LoadConfig() (*Config, error) {
 				SecretKey:       "your-secret-key-here",
 				AccessTokenExp:  15,
 				RefreshTokenExp: 1440,
+				Algorithm:       "RS256",
+				ActiveKid:       "default",
+				Keys: []JWTKeyConfig{
+					{Kid: "default", PrivateKeyFile: "conf/keys/jwt-default.pem"},
+				},
 			},
 			File: FileConfig{
 				UploadDir:      "uploads",
@@ -103,6 +238,70 @@ func LoadConfig() (*Config, error) {
 				Password: "",
 				DB:       0,
 			},
+			Password: PasswordConfig{
+				MinLength:     8,
+				RequireUpper:  true,
+				RequireLower:  true,
+				RequireDigit:  true,
+				HistoryCount:  5,
+				ResetTokenExp: 30,
+			},
+			Mail: MailConfig{
+				Host:     "localhost",
+				Port:     "25",
+				From:     "noreply@example.com",
+				ResetURL: "http://localhost:8080/reset-password",
+			},
+			Auth: AuthConfig{
+				Providers: []string{"local"},
+				LDAP: LDAPConfig{
+					Timeout:       10,
+					UserFilter:    "(uid=%s)",
+					EmailAttr:     "mail",
+					FullNameAttr:  "cn",
+					GroupFilter:   "(member=%s)",
+					GroupNameAttr: "cn",
+					DefaultRole:   "user",
+				},
+				OIDC: OIDCConfig{
+					Scopes:        []string{"openid", "profile", "email"},
+					UsernameClaim: "preferred_username",
+					EmailClaim:    "email",
+					NameClaim:     "name",
+					GroupsClaim:   "groups",
+					DefaultRole:   "user",
+				},
+			},
+			OperationLog: OperationLogConfig{
+				BufferSize:         1024,
+				BatchSize:          100,
+				FlushInterval:      2,
+				MaxBodySize:        4096,
+				CheckpointInterval: 60,
+				RetentionDays:      180,
+				ArchiveDir:         "archives/operation_logs",
+			},
+			WebSocket: WebSocketConfig{
+				AllowedOrigins:     []string{"http://localhost:3000"},
+				SendQueueSize:      256,
+				SlowConsumerPolicy: "coalesce",
+				PingInterval:       30,
+				PongTimeout:        60,
+				Broker:             "memory",
+				BrokerChannel:      "ft:websocket",
+			},
+			Agent: AgentConfig{
+				HeartbeatRetentionDays:   7,
+				PerformanceRetentionDays: 30,
+				DegradedAfter:            90,
+				OfflineAfter:             300,
+				TaskTimeout:              600,
+				TasksPerHeartbeat:        5,
+			},
+			Client: ClientConfig{
+				SignatureWindow:   300,
+				SecretGracePeriod: 600,
+			},
 			Log: struct {
 				Level string `yaml:"level"`
 			}{
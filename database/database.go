@@ -35,6 +35,8 @@ func Connect(cfg *config.DatabaseConfig) error {
 		NowFunc: func() time.Time {
 			return time.Now().Local()
 		},
+		// 唯一索引冲突转换为gorm.ErrDuplicatedKey
+		TranslateError: true,
 	})
 
 	if err != nil {
@@ -75,11 +77,29 @@ func Migrate() error {
 		&models.Share{},
 		&models.Machine{},
 		&models.OperationLog{},
+		&models.OperationLogChainHead{},
+		&models.OperationLogArchive{},
 		&models.Permission{},
 		&models.RolePermission{},
 		&models.PerformanceData{},
 		&models.K8sVersion{},
 		&models.K8sCluster{},
+		&models.PasswordHistory{},
+		&models.PasswordResetToken{},
+		&models.APIKey{},
+		&models.Role{},
+		&models.ResourceGrant{},
+		&models.AuditCheckpoint{},
+		&models.RevokedToken{},
+		&models.Notification{},
+		&models.Agent{},
+		&models.AgentHeartbeat{},
+		&models.MachineStatusChange{},
+		&models.AgentNonce{},
+		&models.AgentTask{},
+		&models.AgentRelease{},
+		&models.AgentRolloutPolicy{},
+		&models.OIDCSession{},
 	)
 
 	if err != nil {
@@ -90,6 +110,10 @@ func Migrate() error {
 	// 初始化K8s版本数据
 	initK8sVersions()
 
+	// 初始化默认角色和权限
+	initDefaultRoles()
+	initDefaultPermissions()
+
 	logger.Info("数据库迁移完成")
 	return nil
 }
@@ -136,6 +160,104 @@ func initK8sVersions() {
 	}
 }
 
+// initDefaultRoles 初始化内置角色，并为已有数据中引用的角色补建记录
+func initDefaultRoles() {
+	logger.Debug("检查默认角色数据")
+
+	systemRoles := []models.Role{
+		{Name: "admin", DisplayName: "管理员", Description: "拥有全部权限", IsSystem: true},
+		{Name: "user", DisplayName: "普通用户", Description: "默认角色", IsSystem: true},
+	}
+	for _, role := range systemRoles {
+		if err := DB.Where(models.Role{Name: role.Name}).FirstOrCreate(&role).Error; err != nil {
+			logger.Error("创建默认角色失败: %v", err)
+			return
+		}
+	}
+
+	// 角色表建立前用户和角色权限中使用的角色名
+	var names []string
+	DB.Model(&models.User{}).Distinct().Pluck("role", &names)
+	var permissionRoles []string
+	DB.Model(&models.RolePermission{}).Distinct().Pluck("role_id", &permissionRoles)
+	names = append(names, permissionRoles...)
+
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		role := models.Role{Name: name, DisplayName: name}
+		if err := DB.Where(models.Role{Name: name}).FirstOrCreate(&role).Error; err != nil {
+			logger.Error("补建角色失败: %v", err)
+			return
+		}
+	}
+}
+
+// defaultPermission 默认权限及默认拥有该权限的角色
+type defaultPermission struct {
+	Name        string
+	Code        string
+	Description string
+	Roles       []string
+}
+
+// defaultPermissions 路由使用的权限代码，admin拥有全部权限
+var defaultPermissions = []defaultPermission{
+	{"仪表盘", "dashboard_view", "查看仪表盘", []string{"admin", "user"}},
+	{"查看用户", "user_view", "查看用户列表和详情", []string{"admin"}},
+	{"用户管理", "user_manage", "管理系统用户", []string{"admin"}},
+	{"查看机器", "machine_view", "查看机器列表和详情", []string{"admin", "user"}},
+	{"机器管理", "machine_manage", "管理服务器机器", []string{"admin"}},
+	{"代理任务", "agent_task_manage", "向客户端代理下发和取消任务", []string{"admin"}},
+	{"查看文件", "file_view", "查看文件列表和详情", []string{"admin", "user"}},
+	{"文件管理", "file_manage", "上传、删除和分享文件", []string{"admin", "user"}},
+	{"传输记录", "transfer_view", "查看传输记录", []string{"admin", "user"}},
+	{"安全审计", "security_audit", "查看安全审计日志", []string{"admin"}},
+	{"查看权限", "permission_view", "查看权限和角色权限", []string{"admin"}},
+	{"权限管理", "permission_manage", "管理系统权限", []string{"admin"}},
+	{"备份恢复", "backup_manage", "备份与恢复数据", []string{"admin"}},
+	{"性能分析", "performance_view", "查看性能数据和报告", []string{"admin", "user"}},
+	{"K8s部署", "k8s_view", "查看K8s部署信息", []string{"admin", "user"}},
+	{"调试接口", "debug_access", "访问调试接口", []string{"admin"}},
+}
+
+// initDefaultPermissions 初始化默认权限，只有新创建的权限才会分配给默认角色，
+// 避免覆盖管理员对角色权限的调整
+func initDefaultPermissions() {
+	logger.Debug("检查默认权限数据")
+
+	created := 0
+	for _, dp := range defaultPermissions {
+		var permission models.Permission
+		result := DB.Where("code = ?", dp.Code).First(&permission)
+		if result.Error == nil {
+			continue
+		}
+		if result.Error != gorm.ErrRecordNotFound {
+			logger.Error("查询权限失败: %v", result.Error)
+			return
+		}
+
+		permission = models.Permission{Name: dp.Name, Code: dp.Code, Description: dp.Description}
+		if err := DB.Create(&permission).Error; err != nil {
+			logger.Error("创建默认权限失败: %v", err)
+			return
+		}
+		for _, role := range dp.Roles {
+			if err := DB.Create(&models.RolePermission{RoleID: role, PermissionID: permission.ID}).Error; err != nil {
+				logger.Error("分配默认权限失败: %v", err)
+				return
+			}
+		}
+		created++
+	}
+
+	if created > 0 {
+		logger.Info("成功初始化 %d 个默认权限", created)
+	}
+}
+
 // GetK8sVersions 从数据库中获取所有有效的Kubernetes版本
 func GetK8sVersions() ([]models.K8sVersion, error) {
 	logger.Debug("获取K8s版本列表")
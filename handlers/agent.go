@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"ft-backend/common/config"
+	"ft-backend/database"
+	"ft-backend/iotservice"
+	"ft-backend/models"
+	"ft-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetAgents 获取客户端代理列表，按最后心跳时间倒序
+func GetAgents(c *gin.Context) {
+	// 解析查询参数
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	status := c.Query("status")
+	version := c.Query("version")
+	keyword := c.Query("keyword")
+	machineID := c.Query("machineId")
+
+	// 计算偏移量
+	offset := (page - 1) * pageSize
+
+	// 构建查询，只包含用户有权访问的机器上的代理
+	db := scopeAgents(c, database.DB.Model(&models.Agent{}))
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+	if version != "" {
+		db = db.Where("version = ?", version)
+	}
+	if keyword != "" {
+		like := "%" + keyword + "%"
+		db = db.Where("client_id LIKE ? OR hostname LIKE ? OR local_ip LIKE ?", like, like, like)
+	}
+	if machineID != "" {
+		db = db.Where("machine_id = ?", machineID)
+	}
+
+	// 获取总数
+	var total int64
+	db.Count(&total)
+
+	// 获取数据
+	var agents []models.Agent
+	db.Limit(pageSize).Offset(offset).Order("last_seen_at DESC").Find(&agents)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"list":  agents,
+			"total": total,
+		},
+		"msg": "success",
+	})
+}
+
+// GetAgentDetail 获取客户端代理详情，包含关联的机器和最近的心跳样本
+func GetAgentDetail(c *gin.Context) {
+	agent, ok := findAgent(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 500 {
+		limit = 20
+	}
+	var heartbeats []models.AgentHeartbeat
+	database.DB.Where("agent_id = ?", agent.ID).Order("received_at DESC").Limit(limit).Find(&heartbeats)
+
+	var machine *models.Machine
+	if agent.MachineID != nil {
+		var linked models.Machine
+		if err := database.DB.Where("deleted_at IS NULL").First(&linked, *agent.MachineID).Error; err == nil {
+			machine = &linked
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"agent":      agent,
+			"machine":    machine,
+			"heartbeats": heartbeats,
+		},
+		"msg": "success",
+	})
+}
+
+// ResetAgentSecret 管理员为代理重新生成签名密钥，新密钥只在响应中返回一次，旧密钥在宽限期内仍有效
+func ResetAgentSecret(c *gin.Context) {
+	agent, ok := findAgent(c)
+	if !ok {
+		return
+	}
+	if agent.RevokedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "代理已吊销"})
+		return
+	}
+
+	cfg := c.MustGet("config").(*config.Config)
+	secret, err := iotservice.RotateSecret(agent, cfg.Client)
+	if err != nil {
+		if err == utils.ErrEncryptKeyMissing {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "未配置client.encrypt_key"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "重置代理密钥失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"agent_id":                   agent.ID,
+			"secret":                     secret,
+			"previous_secret_expires_at": agent.PreviousSecretExpiresAt,
+		},
+		"msg": "success",
+	})
+}
+
+// LinkAgentMachineRequest 关联机器请求
+type LinkAgentMachineRequest struct {
+	MachineID uint `json:"machine_id" binding:"required"`
+}
+
+// LinkAgentMachine 确认代理关联的机器，通常取自代理的suggested_machine_id。
+// 关联后该代理的心跳决定机器状态，已关联其他未吊销代理的机器不能再关联
+func LinkAgentMachine(c *gin.Context) {
+	agent, ok := findAgent(c)
+	if !ok {
+		return
+	}
+	if agent.RevokedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "代理已吊销"})
+		return
+	}
+
+	var request LinkAgentMachineRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "请求参数错误"})
+		return
+	}
+
+	// 只能关联到有权管理的机器
+	if scope := resourceScope(c); !scope.All {
+		var machine models.Machine
+		err := database.DB.Where("deleted_at IS NULL").First(&machine, request.MachineID).Error
+		if err == nil && !scope.Allows(machine.ID, machine.GroupName) {
+			respondMachineForbidden(c)
+			return
+		}
+	}
+
+	if err := iotservice.LinkMachine(agent, request.MachineID, c.GetString("username")); err != nil {
+		switch err {
+		case iotservice.ErrMachineNotFound:
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "机器不存在"})
+		case iotservice.ErrMachineBound:
+			c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": "机器已关联其他代理"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "关联机器失败"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": agent,
+		"msg":  "success",
+	})
+}
+
+// UnlinkAgentMachine 解除代理与机器的关联
+func UnlinkAgentMachine(c *gin.Context) {
+	agent, ok := findAgent(c)
+	if !ok {
+		return
+	}
+
+	if err := iotservice.UnlinkMachine(agent); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "解除关联失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": agent,
+		"msg":  "success",
+	})
+}
+
+// findAgent 按路径参数查询代理并检查资源范围，失败时写入响应
+func findAgent(c *gin.Context) (*models.Agent, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "无效的代理ID"})
+		return nil, false
+	}
+
+	var agent models.Agent
+	if err := database.DB.First(&agent, uint(id)).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "代理不存在"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "查询代理失败"})
+		return nil, false
+	}
+	if !authorizeAgent(c, &agent) {
+		return nil, false
+	}
+	return &agent, true
+}
+
+// scopeAgents 按关联的机器过滤代理，未关联机器的代理只有全局拥有权限的用户可见
+func scopeAgents(c *gin.Context, db *gorm.DB) *gorm.DB {
+	scope := resourceScope(c)
+	if scope.All {
+		return db
+	}
+	machines := scope.Apply(database.DB.Model(&models.Machine{}).Select("id").Where("deleted_at IS NULL"))
+	return db.Where("machine_id IN (?)", machines)
+}
+
+// authorizeAgent 按代理关联的机器检查资源范围，未关联机器的代理只有全局拥有权限的用户可以访问，失败时写入响应
+func authorizeAgent(c *gin.Context, agent *models.Agent) bool {
+	scope := resourceScope(c)
+	if scope.All {
+		return true
+	}
+	if agent.MachineID != nil {
+		var machine models.Machine
+		err := database.DB.Where("deleted_at IS NULL").First(&machine, *agent.MachineID).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "查询机器失败"})
+			return false
+		}
+		if err == nil && scope.Allows(machine.ID, machine.GroupName) {
+			return true
+		}
+	}
+	c.JSON(http.StatusForbidden, gin.H{"code": 403, "msg": "没有权限访问该代理"})
+	return false
+}
+
+// RevokeAgent 吊销代理，之后该代理的请求和重新注册都会被拒绝，并解除与机器的关联
+func RevokeAgent(c *gin.Context) {
+	agent, ok := findAgent(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	result := database.DB.Model(&models.Agent{}).Where("id = ? AND revoked_at IS NULL", agent.ID).Updates(map[string]interface{}{
+		"revoked_at":                 now,
+		"secret_cipher":              "",
+		"previous_secret_cipher":     "",
+		"previous_secret_expires_at": nil,
+		"machine_id":                 nil,
+	})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "吊销代理失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "代理不存在或已吊销"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "success",
+	})
+}
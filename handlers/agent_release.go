@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"ft-backend/database"
+	"ft-backend/iotservice"
+	"ft-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateAgentReleaseRequest 创建发布版本请求，安装包先通过文件上传接口上传
+type CreateAgentReleaseRequest struct {
+	Version  string `json:"version" binding:"required,max=50"`
+	FileID   uint   `json:"file_id" binding:"required"`
+	Checksum string `json:"checksum"` // 可选，填写时必须与上传文件的SHA-256一致
+	Notes    string `json:"notes"`
+}
+
+// SaveAgentRolloutRequest 保存分组版本策略请求
+type SaveAgentRolloutRequest struct {
+	Group      string `json:"group" binding:"max=50"`
+	Version    string `json:"version" binding:"required"`
+	Percentage int    `json:"percentage" binding:"min=0,max=100"`
+	Paused     bool   `json:"paused"`
+}
+
+// GetAgentReleases 获取发布版本列表，按创建时间倒序
+func GetAgentReleases(c *gin.Context) {
+	var releases []models.AgentRelease
+	if err := database.DB.Order("id DESC").Find(&releases).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "查询发布版本失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": releases,
+		"msg":  "success",
+	})
+}
+
+// CreateAgentRelease 创建发布版本，校验值取上传文件的SHA-256
+func CreateAgentRelease(c *gin.Context) {
+	var request CreateAgentReleaseRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "请求参数错误"})
+		return
+	}
+	request.Version = strings.TrimSpace(request.Version)
+	if request.Version == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "版本号不能为空"})
+		return
+	}
+
+	var file models.File
+	if err := database.DB.Where("id = ? AND status = ?", request.FileID, "available").First(&file).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "安装包文件不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "查询文件失败"})
+		return
+	}
+	if request.Checksum != "" && !strings.EqualFold(request.Checksum, file.Hash) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "校验值与安装包不一致"})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.AgentRelease{}).Where("version = ?", request.Version).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": "版本已存在"})
+		return
+	}
+
+	release := models.AgentRelease{
+		Version:   request.Version,
+		FileID:    file.ID,
+		Checksum:  file.Hash,
+		Size:      file.Size,
+		Notes:     request.Notes,
+		CreatedBy: c.GetString("username"),
+	}
+	if err := database.DB.Create(&release).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "创建发布版本失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": release,
+		"msg":  "success",
+	})
+}
+
+// DeleteAgentRelease 删除发布版本，仍被版本策略使用的版本不能删除
+func DeleteAgentRelease(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "无效的版本ID"})
+		return
+	}
+
+	var release models.AgentRelease
+	if err := database.DB.First(&release, uint(id)).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "发布版本不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "查询发布版本失败"})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.AgentRolloutPolicy{}).Where("version = ?", release.Version).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": "版本正在被版本策略使用"})
+		return
+	}
+
+	if err := database.DB.Delete(&release).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "删除发布版本失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "success",
+	})
+}
+
+// GetAgentRollouts 获取各分组的版本策略和灰度进度
+func GetAgentRollouts(c *gin.Context) {
+	progress, err := iotservice.GetRolloutProgress()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "查询灰度进度失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": progress,
+		"msg":  "success",
+	})
+}
+
+// SaveAgentRollout 创建或更新分组的版本策略，代理在下一次心跳时按新策略获得升级指令
+func SaveAgentRollout(c *gin.Context) {
+	var request SaveAgentRolloutRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "请求参数错误"})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.AgentRelease{}).Where("version = ?", request.Version).Count(&count)
+	if count == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "发布版本不存在"})
+		return
+	}
+
+	var policy models.AgentRolloutPolicy
+	err := database.DB.Where("group_name = ?", request.Group).First(&policy).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "查询版本策略失败"})
+		return
+	}
+	policy.GroupName = request.Group
+	policy.Version = request.Version
+	policy.Percentage = request.Percentage
+	policy.Paused = request.Paused
+	policy.UpdatedBy = c.GetString("username")
+	if err := database.DB.Save(&policy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "保存版本策略失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": policy,
+		"msg":  "success",
+	})
+}
+
+// DeleteAgentRollout 删除分组的版本策略，分组内的代理不再收到升级指令
+func DeleteAgentRollout(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "无效的策略ID"})
+		return
+	}
+
+	result := database.DB.Delete(&models.AgentRolloutPolicy{}, uint(id))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "删除版本策略失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "版本策略不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "success",
+	})
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"ft-backend/common/config"
+	"ft-backend/database"
+	"ft-backend/iotservice"
+	"ft-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateAgentTaskRequest 创建代理任务请求
+type CreateAgentTaskRequest struct {
+	Type       string          `json:"type" binding:"required"`
+	Payload    json.RawMessage `json:"payload"`
+	Timeout    int             `json:"timeout"` // 秒，为0时使用agent.task_timeout
+	MaxRetries int             `json:"max_retries"`
+}
+
+// validateTaskPayload 检查任务参数是否包含该类型必需的字段
+func validateTaskPayload(taskType string, payload json.RawMessage) string {
+	var fields map[string]json.RawMessage
+	if len(payload) == 0 || json.Unmarshal(payload, &fields) != nil {
+		return "任务参数必须是JSON对象"
+	}
+
+	var required string
+	switch taskType {
+	case iotservice.TaskRunScript:
+		required = "script"
+	case iotservice.TaskCollectLogs:
+		required = "paths"
+	case iotservice.TaskUpgradeAgent:
+		required = "version"
+	case iotservice.TaskUpdateConfig:
+		required = "config"
+	}
+	if value, ok := fields[required]; !ok || string(value) == "null" || string(value) == `""` {
+		return "任务参数缺少" + required
+	}
+	return ""
+}
+
+// CreateAgentTask 为代理创建任务，任务在代理下一次心跳时下发
+func CreateAgentTask(c *gin.Context) {
+	var request CreateAgentTaskRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "请求参数错误"})
+		return
+	}
+	if !iotservice.ValidTaskType(request.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "不支持的任务类型"})
+		return
+	}
+	if msg := validateTaskPayload(request.Type, request.Payload); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": msg})
+		return
+	}
+	if request.Timeout < 0 || request.MaxRetries < 0 || request.MaxRetries > 10 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "超时时间或重试次数无效"})
+		return
+	}
+
+	agent, ok := findAgent(c)
+	if !ok {
+		return
+	}
+	if agent.RevokedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "代理已吊销"})
+		return
+	}
+
+	timeout := request.Timeout
+	if timeout == 0 {
+		timeout = c.MustGet("config").(*config.Config).Agent.TaskTimeout
+	}
+	if timeout <= 0 {
+		timeout = 600
+	}
+
+	task := models.AgentTask{
+		AgentID:    agent.ID,
+		Type:       request.Type,
+		Payload:    request.Payload,
+		Status:     iotservice.TaskPending,
+		Timeout:    timeout,
+		MaxRetries: request.MaxRetries,
+		CreatedBy:  c.GetString("username"),
+	}
+	if err := database.DB.Create(&task).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "创建任务失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": task,
+		"msg":  "success",
+	})
+}
+
+// GetAgentTasks 获取代理的任务列表，按创建时间倒序
+func GetAgentTasks(c *gin.Context) {
+	agent, ok := findAgent(c)
+	if !ok {
+		return
+	}
+
+	// 解析查询参数
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	status := c.Query("status")
+	taskType := c.Query("type")
+
+	// 计算偏移量
+	offset := (page - 1) * pageSize
+
+	// 列表中不返回输出，输出在详情中查看
+	db := database.DB.Model(&models.AgentTask{}).Where("agent_id = ?", agent.ID)
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+	if taskType != "" {
+		db = db.Where("type = ?", taskType)
+	}
+
+	// 获取总数
+	var total int64
+	db.Count(&total)
+
+	// 获取数据
+	var tasks []models.AgentTask
+	db.Omit("output").Limit(pageSize).Offset(offset).Order("id DESC").Find(&tasks)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"list":  tasks,
+			"total": total,
+		},
+		"msg": "success",
+	})
+}
+
+// GetAgentTaskDetail 获取任务详情，包含执行输出
+func GetAgentTaskDetail(c *gin.Context) {
+	task, ok := findAgentTask(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": task,
+		"msg":  "success",
+	})
+}
+
+// CancelAgentTask 取消未结束的任务
+func CancelAgentTask(c *gin.Context) {
+	task, ok := findAgentTask(c)
+	if !ok {
+		return
+	}
+	if iotservice.TaskFinished(task.Status) {
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": "任务已结束"})
+		return
+	}
+
+	canceled, err := iotservice.CancelTask(task)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "取消任务失败"})
+		return
+	}
+	if !canceled {
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": "任务状态已变化，请刷新后重试"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": task,
+		"msg":  "success",
+	})
+}
+
+// findAgentTask 按路径参数查询任务，并按任务所属代理关联的机器检查资源范围，失败时写入响应
+func findAgentTask(c *gin.Context) (*models.AgentTask, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "无效的任务ID"})
+		return nil, false
+	}
+
+	var task models.AgentTask
+	if err := database.DB.First(&task, uint(id)).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "任务不存在"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "查询任务失败"})
+		return nil, false
+	}
+
+	var agent models.Agent
+	if err := database.DB.First(&agent, task.AgentID).Error; err != nil && err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "查询代理失败"})
+		return nil, false
+	}
+	if !authorizeAgent(c, &agent) {
+		return nil, false
+	}
+	return &task, true
+}
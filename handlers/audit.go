@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ft-backend/common/logger"
+	"ft-backend/database"
+	"ft-backend/models"
+	"ft-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VerifyOperationLogs 校验操作日志哈希链，返回第一处断链
+func VerifyOperationLogs(c *gin.Context) {
+	result, err := utils.VerifyOperationLogChain()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "校验操作日志失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": result,
+		"msg":  "success",
+	})
+}
+
+// GetAuditCheckpoints 获取哈希链检查点列表
+func GetAuditCheckpoints(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	offset := (page - 1) * pageSize
+
+	db := database.DB.Model(&models.AuditCheckpoint{})
+
+	var total int64
+	db.Count(&total)
+
+	var checkpoints []models.AuditCheckpoint
+	db.Limit(pageSize).Offset(offset).Order("id DESC").Find(&checkpoints)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"list":  checkpoints,
+			"total": total,
+		},
+		"msg": "success",
+	})
+}
+
+// ExportAuditCheckpoints 以NDJSON格式导出全部检查点，附带JWKS公钥用于外部归档和独立验证
+func ExportAuditCheckpoints(c *gin.Context) {
+	var checkpoints []models.AuditCheckpoint
+	if err := database.DB.Order("id ASC").Find(&checkpoints).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "查询检查点失败",
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("audit-checkpoints-%s.ndjson", time.Now().Format("20060102150405"))
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	encoder.Encode(gin.H{"type": "jwks", "data": utils.GlobalKeySet.JWKS()})
+	for _, checkpoint := range checkpoints {
+		encoder.Encode(gin.H{"type": "checkpoint", "data": checkpoint})
+	}
+}
+
+// operationLogCSVHeader 操作日志CSV导出的列
+var operationLogCSVHeader = []string{
+	"id", "createTime", "username", "operation", "resource", "resourceId", "method", "path",
+	"ip", "userAgent", "status", "errorMessage", "requestBody", "changes", "prevHash", "hash",
+}
+
+// ExportOperationLogs 按列表的过滤条件流式导出操作日志，format支持csv和ndjson
+func ExportOperationLogs(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "ndjson" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "不支持的导出格式",
+		})
+		return
+	}
+
+	rows, err := operationLogQuery(c).Order("id ASC").Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "查询操作日志失败",
+		})
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("operation-logs-%s.%s", time.Now().Format("20060102150405"), format)
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+	}
+	c.Status(http.StatusOK)
+
+	csvWriter := csv.NewWriter(c.Writer)
+	encoder := json.NewEncoder(c.Writer)
+	if format == "csv" {
+		// 写入BOM，便于Excel识别UTF-8
+		c.Writer.WriteString("\xEF\xBB\xBF")
+		csvWriter.Write(operationLogCSVHeader)
+	}
+
+	count := 0
+	for rows.Next() {
+		var entry models.OperationLog
+		if err := database.DB.ScanRows(rows, &entry); err != nil {
+			logger.Error("导出操作日志失败: %v", err)
+			break
+		}
+
+		if format == "csv" {
+			var changes []byte
+			if len(entry.Changes) > 0 {
+				changes, _ = json.Marshal(entry.Changes)
+			}
+			err = csvWriter.Write([]string{
+				strconv.FormatUint(uint64(entry.ID), 10),
+				entry.CreatedAt.Format("2006-01-02 15:04:05"),
+				entry.Username,
+				entry.Operation,
+				entry.Resource,
+				strconv.FormatUint(uint64(entry.ResourceID), 10),
+				entry.Method,
+				entry.Path,
+				entry.IP,
+				entry.UserAgent,
+				entry.Status,
+				entry.ErrorMessage,
+				entry.RequestBody,
+				string(changes),
+				entry.PrevHash,
+				entry.Hash,
+			})
+		} else {
+			err = encoder.Encode(entry)
+		}
+		if err != nil {
+			// 客户端断开连接
+			logger.Debug("Operation log export aborted: %v", err)
+			return
+		}
+
+		count++
+		if count%500 == 0 {
+			csvWriter.Flush()
+			c.Writer.Flush()
+		}
+	}
+	csvWriter.Flush()
+	c.Writer.Flush()
+}
+
+// operationLogStat 按维度聚合的操作统计
+type operationLogStat struct {
+	Key         string  `json:"key"`
+	Total       int64   `json:"total"`
+	Failed      int64   `json:"failed"`
+	FailureRate float64 `json:"failureRate"`
+}
+
+// GetOperationLogStats 按用户和日期聚合操作次数与失败率，支持与列表相同的过滤条件
+func GetOperationLogStats(c *gin.Context) {
+	const selectFields = "COUNT(*) AS total, SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END) AS failed"
+
+	var overall operationLogStat
+	if err := operationLogQuery(c).Select(selectFields).Scan(&overall).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "统计操作日志失败",
+		})
+		return
+	}
+
+	var byUser []operationLogStat
+	if err := operationLogQuery(c).Select("username AS `key`, " + selectFields).
+		Group("username").Order("total DESC").Scan(&byUser).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "统计操作日志失败",
+		})
+		return
+	}
+
+	var byDay []operationLogStat
+	if err := operationLogQuery(c).Select("DATE_FORMAT(created_at, '%Y-%m-%d') AS `key`, " + selectFields).
+		Group("`key`").Order("`key` ASC").Scan(&byDay).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "统计操作日志失败",
+		})
+		return
+	}
+
+	fillFailureRate(&overall)
+	for i := range byUser {
+		fillFailureRate(&byUser[i])
+	}
+	for i := range byDay {
+		fillFailureRate(&byDay[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"total":       overall.Total,
+			"failed":      overall.Failed,
+			"failureRate": overall.FailureRate,
+			"byUser":      byUser,
+			"byDay":       byDay,
+		},
+		"msg": "success",
+	})
+}
+
+// fillFailureRate 计算失败率
+func fillFailureRate(stat *operationLogStat) {
+	if stat.Total > 0 {
+		stat.FailureRate = float64(stat.Failed) / float64(stat.Total)
+	}
+}
+
+// recordChanges 记录实体更新前后的字段级变更，由操作日志中间件写入审计日志
+func recordChanges(c *gin.Context, before, after interface{}) {
+	if changes := utils.DiffModels(before, after); len(changes) > 0 {
+		c.Set("operationChanges", changes)
+	}
+}
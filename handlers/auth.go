@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
 
 	"ft-backend/common/config"
+	"ft-backend/common/logger"
 	"ft-backend/database"
 	"ft-backend/models"
 	"ft-backend/utils"
@@ -15,7 +17,7 @@ import (
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=50"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required"`
 	FullName string `json:"full_name" binding:"omitempty,max=100"`
 }
 
@@ -36,6 +38,13 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	// 校验密码强度
+	cfg := c.MustGet("config").(*config.Config)
+	if err := utils.ValidatePasswordStrength(req.Password, cfg.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+
 	// 检查用户名是否已存在
 	var existingUser models.User
 	if err := database.DB.Where("username = ?", req.Username).First(&existingUser).Error; err == nil {
@@ -100,32 +109,19 @@ func Login(c *gin.Context) {
 	// 获取用户配置
 	cfg := c.MustGet("config").(*config.Config)
 
-	// 查找用户
-	var user models.User
-	if err := database.DB.Where("username = ?", req.Username).First(&user).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "Invalid credentials"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "Database error"})
-		}
-		return
-	}
-
-	// 验证密码
-	if !utils.CheckPasswordHash(req.Password, user.Password) {
+	// 通过认证器链（本地、LDAP等）验证用户名和密码
+	user, err := utils.GlobalAuthenticator.Authenticate(req.Username, req.Password)
+	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "Invalid credentials"})
 		return
 	}
 
-	// 生成访问令牌
-	accessToken, err := utils.GenerateAccessToken(
-		user.ID,
-		user.Username,
-		user.Email,
-		user.Role,
-		cfg.JWT.SecretKey,
-		cfg.JWT.AccessTokenExp,
-	)
+	respondLoginSuccess(c, user, cfg)
+}
+
+// respondLoginSuccess 为已认证的用户签发访问令牌并返回登录结果
+func respondLoginSuccess(c *gin.Context, user *models.User, cfg *config.Config) {
+	accessToken, err := issueAccessToken(user, cfg)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "Failed to generate access token"})
 		return
@@ -135,7 +131,8 @@ func Login(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 		"data": gin.H{
-			"token": accessToken,
+			"token":              accessToken,
+			"mustChangePassword": user.MustChangePassword,
 			"user": gin.H{
 				"id":         user.ID,
 				"username":   user.Username,
@@ -152,6 +149,17 @@ func Login(c *gin.Context) {
 	})
 }
 
+// issueAccessToken 生成访问令牌，需要修改密码的用户令牌带有限制标记
+func issueAccessToken(user *models.User, cfg *config.Config) (string, error) {
+	return utils.SignAccessToken(utils.JWTClaims{
+		UserID:             user.ID,
+		Username:           user.Username,
+		Email:              user.Email,
+		Role:               user.Role,
+		MustChangePassword: user.MustChangePassword,
+	}, cfg.JWT.AccessTokenExp)
+}
+
 // RefreshToken 刷新Token
 func RefreshToken(c *gin.Context) {
 	var req RefreshTokenRequest
@@ -164,7 +172,7 @@ func RefreshToken(c *gin.Context) {
 	cfg := c.MustGet("config").(*config.Config)
 
 	// 解析刷新令牌
-	claims, err := utils.ValidateToken(req.RefreshToken, cfg.JWT.SecretKey)
+	claims, err := utils.ValidateToken(req.RefreshToken)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "Invalid refresh token"})
 		return
@@ -187,7 +195,6 @@ func RefreshToken(c *gin.Context) {
 		user.Username,
 		user.Email,
 		user.Role,
-		cfg.JWT.SecretKey,
 		cfg.JWT.AccessTokenExp,
 	)
 	if err != nil {
@@ -208,8 +215,15 @@ func RefreshToken(c *gin.Context) {
 
 // Logout 用户登出
 func Logout(c *gin.Context) {
-	// 在这个简单实现中，我们只需要客户端删除token即可
-	// 更复杂的实现可以将token添加到黑名单
+	// 吊销当前访问令牌，同时断开使用该令牌的WebSocket连接
+	if tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "); tokenString != "" {
+		if claims, err := utils.ValidateToken(tokenString); err == nil {
+			if err := utils.GlobalTokenRevocations.Revoke(claims); err != nil {
+				logger.Error("吊销令牌失败: %v", err)
+			}
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 		"data": nil,
@@ -3,7 +3,6 @@ package handlers
 import (
 	"net/http"
 
-	"ft-backend/common/config"
 	"ft-backend/common/logger"
 	"ft-backend/utils"
 
@@ -15,18 +14,13 @@ import (
 func DebugGetToken(c *gin.Context) {
 	logger.Debug("DebugGetToken called")
 
-	// 获取配置
-	cfg := c.MustGet("config").(*config.Config)
-	logger.Debug("JWT Secret Key: %s", cfg.JWT.SecretKey)
-
 	// 生成测试token
 	token, err := utils.GenerateAccessToken(
 		1,                   // 用户ID
 		"admin",             // 用户名
 		"admin@example.com", // 邮箱
 		"admin",             // 角色
-		cfg.JWT.SecretKey,
-		60, // 1小时过期
+		60,                  // 1小时过期
 	)
 
 	if err != nil {
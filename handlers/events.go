@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"ft-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// eventsToken 从Authorization头或查询参数token获取令牌，浏览器的EventSource无法设置请求头
+func eventsToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	return r.URL.Query().Get("token")
+}
+
+// lastEventID 获取客户端最后收到的事件ID，EventSource重连时通过Last-Event-ID头传递
+func lastEventID(r *http.Request) uint64 {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("lastEventId")
+	}
+	id, _ := strconv.ParseUint(value, 10, 64)
+	return id
+}
+
+// EventsHandler SSE事件流，推送与WebSocket相同的消息，用于无法升级WebSocket的网络环境。
+// 查询参数topics为逗号分隔的主题列表，Last-Event-ID用于补发断开期间的通知
+func EventsHandler(c *gin.Context) {
+	claims, ok := authenticateStream(c, eventsToken(c.Request))
+	if !ok {
+		return
+	}
+
+	var topics []string
+	for _, topic := range strings.Split(c.Query("topics"), ",") {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+
+	client := utils.NewSSEClient(claims, utils.GlobalWebSocketManager)
+	client.Manager.RegisterClient(client)
+	if err := client.SubscribeTopics(topics); err != nil {
+		client.Manager.UnregisterClient(client)
+		c.JSON(http.StatusForbidden, gin.H{
+			"code": 403,
+			"msg":  "无权订阅主题 " + err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 关闭nginx缓冲
+	c.Status(http.StatusOK)
+
+	client.SendMessage(utils.WebSocketMessage{
+		Type:    "connected",
+		UserID:  client.ID,
+		Message: "Event stream established",
+	})
+
+	client.ServeSSE(c.Request.Context(), c.Writer, lastEventID(c.Request))
+}
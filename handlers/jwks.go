@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"net/http"
+
+	"ft-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJWKS 公开JWT验证公钥，供其他服务验证本系统签发的令牌
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utils.GlobalKeySet.JWKS())
+}
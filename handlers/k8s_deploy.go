@@ -5,6 +5,7 @@ import (
 
 	"ft-backend/database"
 	"ft-backend/models"
+	"ft-backend/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -34,8 +35,19 @@ func GetK8sDeployMachines(c *gin.Context) {
 	var machines []models.Machine
 	status := c.Query("status")
 
+	// 只返回有查看权限的机器
+	scope, err := utils.ResolveResourceScope(c.GetString("username"), c.GetString("role"), utils.ResourceMachine, "machine_view")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "Failed to fetch machines",
+			"data": nil,
+		})
+		return
+	}
+
 	// 构建查询条件
-	query := database.DB
+	query := scope.Apply(database.DB)
 	if status != "" {
 		query = query.Where("status = ?", status)
 	}
@@ -57,6 +69,30 @@ func GetK8sDeployMachines(c *gin.Context) {
 	})
 }
 
+// GetK8sClusters 获取有权限查看的K8s集群列表
+func GetK8sClusters(c *gin.Context) {
+	var clusters []models.K8sCluster
+	query := resourceScope(c).Apply(database.DB.Model(&models.K8sCluster{}))
+	if group := c.Query("group"); group != "" {
+		query = query.Where("group_name = ?", group)
+	}
+
+	if err := query.Order("created_at DESC").Find(&clusters).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "Failed to fetch clusters",
+			"data": nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "success",
+		"data": clusters,
+	})
+}
+
 // CheckClusterName 检查集群名称是否可用
 func CheckClusterName(c *gin.Context) {
 	clusterName := c.Query("params[clusterName]")
@@ -3,14 +3,40 @@ package handlers
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"ft-backend/database"
 	"ft-backend/models"
+	"ft-backend/utils"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
+// resourceScope 获取RequireResourcePermission计算出的资源范围，未经该中间件的路由视为不受限
+func resourceScope(c *gin.Context) *utils.ResourceScope {
+	if scope, ok := c.Get("resourceScope"); ok {
+		return scope.(*utils.ResourceScope)
+	}
+	return &utils.ResourceScope{All: true}
+}
+
+// publishMachineEvent 向订阅了该机器的连接推送变更
+func publishMachineEvent(eventType string, machine models.Machine) {
+	utils.GlobalWebSocketManager.Publish(utils.MachineTopic(machine.ID), utils.WebSocketMessage{
+		Type: eventType,
+		Data: machine,
+	})
+}
+
+// respondMachineForbidden 无权访问该机器
+func respondMachineForbidden(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"code": 403,
+		"msg":  "没有权限访问该机器",
+	})
+}
+
 // GetMachineList 获取机器列表
 func GetMachineList(c *gin.Context) {
 	// 解析查询参数
@@ -24,8 +50,8 @@ func GetMachineList(c *gin.Context) {
 	// 计算偏移量
 	offset := (page - 1) * pageSize
 
-	// 构建查询
-	db := database.DB.Model(&models.Machine{})
+	// 构建查询，只返回有权限查看的机器
+	db := resourceScope(c).Apply(database.DB.Model(&models.Machine{}))
 
 	// 添加过滤条件
 	if name != "" {
@@ -91,6 +117,11 @@ func GetMachineDetail(c *gin.Context) {
 		return
 	}
 
+	if !resourceScope(c).Allows(machine.ID, machine.GroupName) {
+		respondMachineForbidden(c)
+		return
+	}
+
 	// 返回结果
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
@@ -111,6 +142,12 @@ func AddMachine(c *gin.Context) {
 		return
 	}
 
+	// 只能在有权限的分组中添加机器
+	if !resourceScope(c).AllowsGroup(machine.GroupName) {
+		respondMachineForbidden(c)
+		return
+	}
+
 	// 保存机器
 	result := database.DB.Create(&machine)
 	if result.Error != nil {
@@ -170,8 +207,22 @@ func UpdateMachine(c *gin.Context) {
 		return
 	}
 
-	// 更新机器
+	// 原机器和更新后的分组都需要在权限范围内
+	scope := resourceScope(c)
+	if !scope.Allows(existingMachine.ID, existingMachine.GroupName) ||
+		(machine.GroupName != existingMachine.GroupName && !scope.AllowsGroup(machine.GroupName)) {
+		respondMachineForbidden(c)
+		return
+	}
+
+	// 更新机器，状态变化时记录变更时间
 	machine.ID = uint(id)
+	machine.StatusChangedAt = existingMachine.StatusChangedAt
+	statusChanged := machine.Status != existingMachine.Status
+	if statusChanged {
+		now := time.Now()
+		machine.StatusChangedAt = &now
+	}
 	result = database.DB.Save(&machine)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -180,6 +231,11 @@ func UpdateMachine(c *gin.Context) {
 		})
 		return
 	}
+	if statusChanged {
+		utils.RecordMachineStatusChange(machine.ID, existingMachine.Status, machine.Status, utils.StatusReasonManual, c.GetString("username"), *machine.StatusChangedAt)
+	}
+	recordChanges(c, existingMachine, machine)
+	publishMachineEvent("machine_updated", machine)
 
 	// 返回结果
 	c.JSON(http.StatusOK, gin.H{
@@ -220,6 +276,11 @@ func DeleteMachine(c *gin.Context) {
 		return
 	}
 
+	if !resourceScope(c).Allows(machine.ID, machine.GroupName) {
+		respondMachineForbidden(c)
+		return
+	}
+
 	// 删除机器（软删除）
 	result = database.DB.Delete(&machine)
 	if result.Error != nil {
@@ -229,6 +290,7 @@ func DeleteMachine(c *gin.Context) {
 		})
 		return
 	}
+	publishMachineEvent("machine_deleted", machine)
 
 	// 返回结果
 	c.JSON(http.StatusOK, gin.H{
@@ -251,8 +313,29 @@ func BatchDeleteMachine(c *gin.Context) {
 		return
 	}
 
-	// 批量删除机器（软删除）
-	result := database.DB.Delete(&models.Machine{}, request.IDs)
+	if len(request.IDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的请求参数",
+		})
+		return
+	}
+
+	// 批量删除机器（软删除），只删除有权限管理的机器
+	var count int64
+	scope := resourceScope(c)
+	if err := scope.Apply(database.DB.Model(&models.Machine{}).Where("id IN ?", request.IDs)).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "查询机器失败",
+		})
+		return
+	}
+	if count != int64(len(request.IDs)) {
+		respondMachineForbidden(c)
+		return
+	}
+	result := scope.Apply(database.DB.Where("id IN ?", request.IDs)).Delete(&models.Machine{})
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code": 500,
@@ -311,21 +394,96 @@ func UpdateMachineStatus(c *gin.Context) {
 		return
 	}
 
-	// 更新机器状态
-	machine.Status = request.Status
-	result = database.DB.Save(&machine)
+	if !resourceScope(c).Allows(machine.ID, machine.GroupName) {
+		respondMachineForbidden(c)
+		return
+	}
+
+	// 更新机器状态，状态未变化时不记录变更
+	before := machine
+	if request.Status != machine.Status {
+		ok, err := utils.TransitionMachineStatus(&machine, request.Status, utils.StatusReasonManual, c.GetString("username"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code": 500,
+				"msg":  "更新机器状态失败",
+			})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusConflict, gin.H{
+				"code": 409,
+				"msg":  "机器状态已被修改，请刷新后重试",
+			})
+			return
+		}
+		recordChanges(c, before, machine)
+		publishMachineEvent("machine_status_update", machine)
+	}
+
+	// 返回结果
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": machine,
+		"msg":  "success",
+	})
+}
+
+// GetMachineStatusHistory 获取机器的状态变更记录
+func GetMachineStatusHistory(c *gin.Context) {
+	// 解析ID参数
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的机器ID",
+		})
+		return
+	}
+
+	// 查询机器
+	var machine models.Machine
+	result := database.DB.First(&machine, uint(id))
 	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code": 404,
+				"msg":  "机器不存在",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code": 500,
-			"msg":  "更新机器状态失败",
+			"msg":  "查询机器失败",
 		})
 		return
 	}
 
+	if !resourceScope(c).Allows(machine.ID, machine.GroupName) {
+		respondMachineForbidden(c)
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	offset := (page - 1) * pageSize
+
+	db := database.DB.Model(&models.MachineStatusChange{}).Where("machine_id = ?", machine.ID)
+
+	var total int64
+	db.Count(&total)
+
+	var changes []models.MachineStatusChange
+	db.Limit(pageSize).Offset(offset).Order("changed_at DESC").Find(&changes)
+
 	// 返回结果
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
-		"data": machine,
-		"msg":  "success",
+		"data": gin.H{
+			"list":  changes,
+			"total": total,
+		},
+		"msg": "success",
 	})
 }
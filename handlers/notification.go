@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"ft-backend/database"
+	"ft-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetNotifications 获取当前用户的通知列表，unread=true时只返回未读通知
+func GetNotifications(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "msg": "未授权"})
+		return
+	}
+
+	// 解析查询参数
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	offset := (page - 1) * pageSize
+
+	db := database.DB.Model(&models.Notification{}).Where("user_id = ?", userID)
+	if c.Query("unread") == "true" {
+		db = db.Where("read_at IS NULL")
+	}
+
+	var total int64
+	db.Count(&total)
+
+	var notifications []models.Notification
+	if err := db.Limit(pageSize).Offset(offset).Order("seq DESC").Find(&notifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "查询通知失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"list":  notifications,
+			"total": total,
+		},
+		"msg": "success",
+	})
+}
+
+// GetUnreadNotificationCount 获取当前用户的未读通知数和最新序号
+func GetUnreadNotificationCount(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "msg": "未授权"})
+		return
+	}
+
+	var unread int64
+	if err := database.DB.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&unread).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "查询通知失败"})
+		return
+	}
+
+	var lastSeq uint64
+	database.DB.Model(&models.Notification{}).Where("user_id = ?", userID).Select("COALESCE(MAX(seq), 0)").Scan(&lastSeq)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"unread":   unread,
+			"last_seq": lastSeq,
+		},
+		"msg": "success",
+	})
+}
+
+// MarkNotificationRead 将当前用户的一条通知标记为已读
+func MarkNotificationRead(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "msg": "未授权"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "无效的通知ID"})
+		return
+	}
+
+	var notification models.Notification
+	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&notification).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "通知不存在"})
+		return
+	}
+
+	if notification.ReadAt == nil {
+		now := time.Now()
+		if err := database.DB.Model(&notification).Update("read_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "标记已读失败"})
+			return
+		}
+		notification.ReadAt = &now
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": notification,
+		"msg":  "success",
+	})
+}
+
+// MarkAllNotificationsRead 将当前用户的通知全部标记为已读，指定up_to_seq时只标记该序号及之前的通知
+func MarkAllNotificationsRead(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "msg": "未授权"})
+		return
+	}
+
+	var request struct {
+		UpToSeq uint64 `json:"up_to_seq"`
+	}
+	// 请求体可以为空
+	c.ShouldBindJSON(&request)
+
+	db := database.DB.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID)
+	if request.UpToSeq > 0 {
+		db = db.Where("seq <= ?", request.UpToSeq)
+	}
+	result := db.Update("read_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "标记已读失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{"updated": result.RowsAffected},
+		"msg":  "success",
+	})
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"ft-backend/common/config"
+	"ft-backend/common/logger"
+	"ft-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OIDC登录的state Cookie，保存state的哈希，回调时校验请求来自发起登录的浏览器
+const (
+	oidcStateCookie     = "ft_oidc_state"
+	oidcStateCookiePath = "/api/auth/oidc"
+	oidcStateCookieAge  = 600 // 与登录流程有效期一致（秒）
+)
+
+// OIDCLogin 跳转到OIDC身份提供方登录
+func OIDCLogin(c *gin.Context) {
+	if utils.GlobalOIDCProvider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "未启用单点登录"})
+		return
+	}
+
+	authURL, state, err := utils.GlobalOIDCProvider.AuthCodeURL()
+	if err != nil {
+		logger.Error("生成OIDC登录地址失败: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"code": 502, "msg": "单点登录服务不可用"})
+		return
+	}
+
+	setOIDCStateCookie(c, utils.HashToken(state), oidcStateCookieAge)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// setOIDCStateCookie 设置或清除（maxAge<0）state Cookie。
+// SameSite=Lax 允许身份提供方跳转回来的顶级GET请求携带Cookie
+func setOIDCStateCookie(c *gin.Context, value string, maxAge int) {
+	cfg := c.MustGet("config").(*config.Config)
+	secure := c.Request.TLS != nil || strings.HasPrefix(cfg.Auth.OIDC.RedirectURL, "https://")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, value, maxAge, oidcStateCookiePath, "", secure, true)
+}
+
+// OIDCCallback OIDC授权回调，验证身份后签发本系统的访问令牌
+func OIDCCallback(c *gin.Context) {
+	if utils.GlobalOIDCProvider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "未启用单点登录"})
+		return
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		logger.Warn("OIDC登录失败: %s %s", errCode, c.Query("error_description"))
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "msg": "单点登录失败"})
+		return
+	}
+
+	state := c.Query("state")
+	code := c.Query("code")
+	if state == "" || code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "无效的回调参数"})
+		return
+	}
+
+	// state必须与本浏览器发起登录时设置的Cookie一致，防止他人的登录流程在受害者浏览器中完成
+	stateHash, _ := c.Cookie(oidcStateCookie)
+	setOIDCStateCookie(c, "", -1)
+	if stateHash == "" || subtle.ConstantTimeCompare([]byte(stateHash), []byte(utils.HashToken(state))) != 1 {
+		logger.Warn("OIDC回调的state与浏览器Cookie不一致")
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "msg": "登录会话无效或已过期，请重新登录"})
+		return
+	}
+
+	cfg := c.MustGet("config").(*config.Config)
+
+	identity, err := utils.GlobalOIDCProvider.Exchange(state, code)
+	if err != nil {
+		logger.Warn("OIDC身份验证失败: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "msg": "单点登录失败"})
+		return
+	}
+
+	role := utils.MapGroupsToRole(identity.Groups, cfg.Auth.OIDC.GroupRoles, cfg.Auth.OIDC.DefaultRole)
+	user, err := utils.ProvisionOIDCUser(identity, role)
+	if err != nil {
+		logger.Warn("OIDC用户同步失败: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "msg": "单点登录失败"})
+		return
+	}
+
+	// 未配置前端地址时直接返回与用户名密码登录相同的结果
+	if cfg.Auth.OIDC.FrontendURL == "" {
+		respondLoginSuccess(c, user, cfg)
+		return
+	}
+
+	token, err := issueAccessToken(user, cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "生成令牌失败"})
+		return
+	}
+
+	// 令牌放在URL片段中，不会出现在服务器访问日志里
+	c.Redirect(http.StatusFound, cfg.Auth.OIDC.FrontendURL+"#token="+url.QueryEscape(token))
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"ft-backend/common/config"
+	"ft-backend/common/logger"
+	"ft-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitLogger("error", io.Discard)
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Auth.OIDC = config.OIDCConfig{Enabled: true, IssuerURL: "https://idp.example.com", RedirectURL: "https://ft.example.com/api/auth/oidc/callback"}
+
+	previous := utils.GlobalOIDCProvider
+	utils.GlobalOIDCProvider = utils.NewOIDCProvider(cfg.Auth.OIDC)
+	defer func() { utils.GlobalOIDCProvider = previous }()
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("config", cfg) })
+	router.GET("/api/auth/oidc/callback", OIDCCallback)
+
+	tests := []struct {
+		name   string
+		cookie string
+	}{
+		{name: "no cookie"},
+		{name: "cookie of another login", cookie: utils.HashToken("other-state")},
+		// Cookie中保存的是哈希，直接放入state本身不能通过
+		{name: "raw state in cookie", cookie: "attacker-state"},
+	}
+	for _, tt := range tests {
+		request := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?state=attacker-state&code=attacker-code", nil)
+		if tt.cookie != "" {
+			request.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: tt.cookie})
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+
+		if recorder.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want 401", tt.name, recorder.Code)
+		}
+		// 无论校验是否通过，state Cookie都只能使用一次
+		cleared := false
+		for _, cookie := range recorder.Result().Cookies() {
+			if cookie.Name == oidcStateCookie && cookie.MaxAge < 0 && cookie.HttpOnly && cookie.Secure && cookie.SameSite == http.SameSiteLaxMode {
+				cleared = true
+			}
+		}
+		if !cleared {
+			t.Errorf("%s: state cookie was not cleared: %v", tt.name, recorder.Header().Values("Set-Cookie"))
+		}
+	}
+}
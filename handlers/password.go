@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ft-backend/common/config"
+	"ft-backend/common/logger"
+	"ft-backend/database"
+	"ft-backend/models"
+	"ft-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errPasswordReused 新密码与近期使用过的密码重复
+var errPasswordReused = errors.New("不能使用最近使用过的密码")
+
+// validateNewPassword 校验新密码强度及是否与历史密码重复
+func validateNewPassword(user *models.User, password string, policy config.PasswordConfig) error {
+	if err := utils.ValidatePasswordStrength(password, policy); err != nil {
+		return err
+	}
+
+	// 新用户没有历史密码
+	if user.ID == 0 {
+		return nil
+	}
+
+	if user.Password != "" && utils.CheckPasswordHash(password, user.Password) {
+		return errPasswordReused
+	}
+
+	if policy.HistoryCount <= 0 {
+		return nil
+	}
+
+	var histories []models.PasswordHistory
+	if err := database.DB.Where("user_id = ?", user.ID).
+		Order("created_at DESC").Limit(policy.HistoryCount).
+		Find(&histories).Error; err != nil {
+		return fmt.Errorf("failed to query password history: %w", err)
+	}
+	for _, h := range histories {
+		if utils.CheckPasswordHash(password, h.Password) {
+			return errPasswordReused
+		}
+	}
+	return nil
+}
+
+// saveNewPassword 保存新密码并记录历史，超出策略数量的旧记录会被清理
+func saveNewPassword(tx *gorm.DB, user *models.User, password string, policy config.PasswordConfig, mustChange bool) error {
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	now := time.Now()
+	user.Password = hashedPassword
+	user.MustChangePassword = mustChange
+	user.PasswordChangedAt = &now
+	if err := tx.Save(user).Error; err != nil {
+		return fmt.Errorf("failed to save user: %w", err)
+	}
+
+	if policy.HistoryCount <= 0 {
+		return nil
+	}
+
+	if err := tx.Create(&models.PasswordHistory{UserID: user.ID, Password: hashedPassword}).Error; err != nil {
+		return fmt.Errorf("failed to save password history: %w", err)
+	}
+
+	var staleIDs []uint
+	tx.Model(&models.PasswordHistory{}).Where("user_id = ?", user.ID).
+		Order("created_at DESC").Offset(policy.HistoryCount).Limit(1000).
+		Pluck("id", &staleIDs)
+	if len(staleIDs) > 0 {
+		if err := tx.Delete(&models.PasswordHistory{}, staleIDs).Error; err != nil {
+			return fmt.Errorf("failed to prune password history: %w", err)
+		}
+	}
+	return nil
+}
+
+// ChangePassword 当前用户修改密码，需要提供旧密码
+func ChangePassword(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "msg": "未授权"})
+		return
+	}
+
+	var request struct {
+		OldPassword string `json:"old_password" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "无效的请求参数"})
+		return
+	}
+
+	cfg := c.MustGet("config").(*config.Config)
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "用户不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "查询用户失败"})
+		return
+	}
+
+	if !utils.CheckPasswordHash(request.OldPassword, user.Password) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "原密码错误"})
+		return
+	}
+
+	if err := validateNewPassword(&user, request.NewPassword, cfg.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return saveNewPassword(tx, &user, request.NewPassword, cfg.Password, false)
+	}); err != nil {
+		logger.Error("修改密码失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "修改密码失败"})
+		return
+	}
+	utils.GlobalTokenRevocations.RevokeUserTokens(&user)
+
+	// 修改密码前签发的令牌已全部失效，签发新令牌供客户端替换
+	token, err := utils.GenerateAccessToken(user.ID, user.Username, user.Email, user.Role, cfg.JWT.AccessTokenExp)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "生成令牌失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"token": token,
+		},
+		"msg": "success",
+	})
+}
+
+// AdminResetPassword 管理员重置用户密码，用户下次登录时必须修改密码
+func AdminResetPassword(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "无效的用户ID"})
+		return
+	}
+
+	// 未指定新密码时生成临时密码
+	var request struct {
+		NewPassword string `json:"new_password"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "无效的请求参数"})
+		return
+	}
+
+	cfg := c.MustGet("config").(*config.Config)
+
+	var user models.User
+	if err := database.DB.First(&user, uint(id)).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "用户不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "查询用户失败"})
+		return
+	}
+
+	if user.AuthSource != "" && user.AuthSource != "local" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "外部目录用户不能重置本地密码"})
+		return
+	}
+
+	password := request.NewPassword
+	generated := password == ""
+	if generated {
+		password, err = utils.GenerateTemporaryPassword(cfg.Password)
+		if err != nil {
+			logger.Error("生成临时密码失败: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "生成临时密码失败"})
+			return
+		}
+	} else if err := utils.ValidatePasswordStrength(password, cfg.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return saveNewPassword(tx, &user, password, cfg.Password, true)
+	}); err != nil {
+		logger.Error("重置密码失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "重置密码失败"})
+		return
+	}
+	utils.GlobalTokenRevocations.RevokeUserTokens(&user)
+
+	data := gin.H{"must_change_password": true}
+	if generated {
+		// 临时密码只在此处返回一次
+		data["temporary_password"] = password
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": data,
+		"msg":  "success",
+	})
+}
+
+// ForgotPassword 发送找回密码链接，无论邮箱是否存在都返回成功，避免泄露用户信息。
+// 查找用户、生成令牌和发送邮件都在后台进行，两种情况的响应时间相同
+func ForgotPassword(c *gin.Context) {
+	var request struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "无效的请求参数"})
+		return
+	}
+
+	cfg := c.MustGet("config").(*config.Config)
+	go sendPasswordResetMail(request.Email, cfg)
+
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success"})
+}
+
+// sendPasswordResetMail 为本地用户生成找回密码令牌并发送邮件，邮箱不存在时什么也不做
+func sendPasswordResetMail(email string, cfg *config.Config) {
+	var user models.User
+	if err := database.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			logger.Error("查询用户失败: %v", err)
+		}
+		return
+	}
+
+	// 外部目录用户的密码不由本系统管理
+	if user.AuthSource != "" && user.AuthSource != "local" {
+		return
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		logger.Error("生成重置令牌失败: %v", err)
+		return
+	}
+
+	expiresIn := cfg.Password.ResetTokenExp
+	if expiresIn <= 0 {
+		expiresIn = 30
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// 旧的未使用令牌全部作废，保证同一时间只有一个有效链接
+		if err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&models.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: time.Now().Add(time.Duration(expiresIn) * time.Minute),
+		}).Error
+	})
+	if err != nil {
+		logger.Error("保存重置令牌失败: %v", err)
+		return
+	}
+
+	link := fmt.Sprintf("%s?token=%s", cfg.Mail.ResetURL, token)
+	body := fmt.Sprintf("您好 %s：\n\n请在%d分钟内点击以下链接重置密码，链接只能使用一次：\n%s\n\n如果这不是您本人的操作，请忽略此邮件。",
+		user.Username, expiresIn, link)
+	if err := utils.GlobalMailer.Send(user.Email, "重置密码", body); err != nil {
+		logger.Error("发送重置密码邮件失败: %v", err)
+	}
+}
+
+// ResetPassword 使用找回密码令牌设置新密码
+func ResetPassword(c *gin.Context) {
+	var request struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "无效的请求参数"})
+		return
+	}
+
+	cfg := c.MustGet("config").(*config.Config)
+
+	var resetToken models.PasswordResetToken
+	if err := database.DB.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?",
+		utils.HashToken(request.Token), time.Now()).First(&resetToken).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "重置链接无效或已过期"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "查询重置令牌失败"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, resetToken.UserID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "重置链接无效或已过期"})
+		return
+	}
+
+	if err := validateNewPassword(&user, request.NewPassword, cfg.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 条件更新保证令牌只能被使用一次
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", resetToken.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return saveNewPassword(tx, &user, request.NewPassword, cfg.Password, false)
+	})
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "重置链接无效或已过期"})
+			return
+		}
+		logger.Error("重置密码失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "重置密码失败"})
+		return
+	}
+	utils.GlobalTokenRevocations.RevokeUserTokens(&user)
+
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "success"})
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"ft-backend/database"
+	"ft-backend/models"
+	"ft-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetResourceGrants 获取资源授权列表
+func GetResourceGrants(c *gin.Context) {
+	db := database.DB.Model(&models.ResourceGrant{})
+	if resourceType := c.Query("resourceType"); resourceType != "" {
+		db = db.Where("resource_type = ?", resourceType)
+	}
+	if subject := c.Query("subject"); subject != "" {
+		db = db.Where("subject = ?", subject)
+	}
+
+	var grants []models.ResourceGrant
+	if err := db.Order("id DESC").Find(&grants).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "查询资源授权失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"list":  grants,
+			"total": len(grants),
+		},
+		"msg": "success",
+	})
+}
+
+// AddResourceGrant 添加资源授权，授权对象为具体资源或资源分组
+func AddResourceGrant(c *gin.Context) {
+	var request struct {
+		SubjectType   string `json:"subjectType" binding:"required,oneof=user role"`
+		Subject       string `json:"subject" binding:"required,max=50"`
+		ResourceType  string `json:"resourceType" binding:"required,oneof=machine cluster"`
+		ResourceID    uint   `json:"resourceId"`
+		ResourceGroup string `json:"resourceGroup" binding:"max=50"`
+		Role          string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的请求参数",
+		})
+		return
+	}
+
+	if (request.ResourceID == 0) == (request.ResourceGroup == "") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "资源ID和资源分组必须且只能指定一个",
+		})
+		return
+	}
+
+	if err := validateRole(request.Role); err != nil {
+		respondRoleError(c, err)
+		return
+	}
+
+	// 校验授权对象
+	var count int64
+	if request.SubjectType == "user" {
+		database.DB.Model(&models.User{}).Where("username = ?", request.Subject).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code": 400,
+				"msg":  "用户不存在",
+			})
+			return
+		}
+	} else if err := validateRole(request.Subject); err != nil {
+		respondRoleError(c, err)
+		return
+	}
+
+	// 校验授权的具体资源
+	if request.ResourceID != 0 {
+		var resource interface{} = &models.Machine{}
+		if request.ResourceType == utils.ResourceCluster {
+			resource = &models.K8sCluster{}
+		}
+		if err := database.DB.First(resource, request.ResourceID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"code": 400,
+					"msg":  "资源不存在",
+				})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code": 500,
+				"msg":  "查询资源失败",
+			})
+			return
+		}
+	}
+
+	grant := models.ResourceGrant{
+		SubjectType:   request.SubjectType,
+		Subject:       request.Subject,
+		ResourceType:  request.ResourceType,
+		ResourceID:    request.ResourceID,
+		ResourceGroup: request.ResourceGroup,
+		Role:          request.Role,
+		CreatedBy:     c.GetString("username"),
+	}
+	if err := database.DB.Create(&grant).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "添加资源授权失败",
+		})
+		return
+	}
+
+	utils.GlobalWebSocketManager.RevalidateSubscriptions()
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": grant,
+		"msg":  "success",
+	})
+}
+
+// DeleteResourceGrant 删除资源授权
+func DeleteResourceGrant(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的授权ID",
+		})
+		return
+	}
+
+	result := database.DB.Delete(&models.ResourceGrant{}, uint(id))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "删除资源授权失败",
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": 404,
+			"msg":  "资源授权不存在",
+		})
+		return
+	}
+
+	// 已订阅被撤销资源的WebSocket/SSE连接取消订阅
+	utils.GlobalWebSocketManager.RevalidateSubscriptions()
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "success",
+	})
+}
+
+// respondRoleError 角色校验失败时的响应
+func respondRoleError(c *gin.Context, err error) {
+	if err == errRoleNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "角色不存在",
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"code": 500,
+		"msg":  "检查角色失败",
+	})
+}
@@ -0,0 +1,395 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"ft-backend/database"
+	"ft-backend/models"
+	"ft-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errRoleNotFound 角色不存在
+var errRoleNotFound = errors.New("角色不存在")
+
+// validateRole 校验角色是否存在
+func validateRole(name string) error {
+	var count int64
+	if err := database.DB.Model(&models.Role{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errRoleNotFound
+	}
+	return nil
+}
+
+// loadRoleParents 加载角色名→父角色名的映射
+func loadRoleParents() (map[string]string, error) {
+	var roles []models.Role
+	if err := database.DB.Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	parents := make(map[string]string, len(roles))
+	for _, role := range roles {
+		parents[role.Name] = role.Parent
+	}
+	return parents, nil
+}
+
+// validateRoleParent 校验父角色存在且不会形成循环继承
+func validateRoleParent(name, parent string) error {
+	if parent == "" {
+		return nil
+	}
+	if parent == name {
+		return errors.New("角色不能继承自身")
+	}
+
+	parents, err := loadRoleParents()
+	if err != nil {
+		return err
+	}
+	if _, ok := parents[parent]; !ok {
+		return errors.New("父角色不存在")
+	}
+
+	for _, ancestor := range utils.RoleChain(parent, parents) {
+		if ancestor == name {
+			return errors.New("角色继承不能形成循环")
+		}
+	}
+	return nil
+}
+
+// GetRoles 获取角色列表
+func GetRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := database.DB.Order("id ASC").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "查询角色失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"list":  roles,
+			"total": len(roles),
+		},
+		"msg": "success",
+	})
+}
+
+// GetRoleDetail 获取角色详情，包含继承链和有效权限
+func GetRoleDetail(c *gin.Context) {
+	name := c.Param("role")
+
+	var role models.Role
+	if err := database.DB.Where("name = ?", name).First(&role).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code": 404,
+				"msg":  "角色不存在",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "查询角色失败",
+		})
+		return
+	}
+
+	parents, err := loadRoleParents()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "查询角色失败",
+		})
+		return
+	}
+
+	permissions, err := utils.GlobalPermissionCache.EffectivePermissions(role.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "查询角色权限失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"role":        role,
+			"inherits":    utils.RoleChain(role.Name, parents)[1:],
+			"permissions": permissions,
+		},
+		"msg": "success",
+	})
+}
+
+// AddRole 添加角色
+func AddRole(c *gin.Context) {
+	var request struct {
+		Name        string `json:"name" binding:"required,max=20"`
+		DisplayName string `json:"displayName" binding:"max=100"`
+		Description string `json:"description" binding:"max=255"`
+		Parent      string `json:"parent"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的请求参数",
+		})
+		return
+	}
+
+	if err := validateRole(request.Name); err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "角色已存在",
+		})
+		return
+	} else if err != errRoleNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "检查角色失败",
+		})
+		return
+	}
+
+	if err := validateRoleParent(request.Name, request.Parent); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  err.Error(),
+		})
+		return
+	}
+
+	role := models.Role{
+		Name:        request.Name,
+		DisplayName: request.DisplayName,
+		Description: request.Description,
+		Parent:      request.Parent,
+	}
+	if err := database.DB.Create(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "添加角色失败",
+		})
+		return
+	}
+
+	utils.GlobalPermissionCache.Invalidate()
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": role,
+		"msg":  "success",
+	})
+}
+
+// UpdateRole 更新角色，角色名不可修改
+func UpdateRole(c *gin.Context) {
+	name := c.Param("role")
+
+	var request struct {
+		DisplayName string `json:"displayName" binding:"max=100"`
+		Description string `json:"description" binding:"max=255"`
+		Parent      string `json:"parent"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的请求参数",
+		})
+		return
+	}
+
+	var role models.Role
+	if err := database.DB.Where("name = ?", name).First(&role).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code": 404,
+				"msg":  "角色不存在",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "查询角色失败",
+		})
+		return
+	}
+
+	if err := validateRoleParent(role.Name, request.Parent); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  err.Error(),
+		})
+		return
+	}
+
+	before := role
+	role.DisplayName = request.DisplayName
+	role.Description = request.Description
+	role.Parent = request.Parent
+	if err := database.DB.Save(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "更新角色失败",
+		})
+		return
+	}
+	recordChanges(c, before, role)
+
+	// 继承关系可能已变更
+	utils.GlobalPermissionCache.Invalidate()
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": role,
+		"msg":  "success",
+	})
+}
+
+// DeleteRole 删除角色，仍被用户使用或被其他角色继承的角色不能删除。
+// 授予该角色或授权给该角色的资源授权一并删除
+func DeleteRole(c *gin.Context) {
+	name := c.Param("role")
+
+	var role models.Role
+	if err := database.DB.Where("name = ?", name).First(&role).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code": 404,
+				"msg":  "角色不存在",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "查询角色失败",
+		})
+		return
+	}
+
+	if role.IsSystem {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "不能删除系统内置角色",
+		})
+		return
+	}
+
+	var userCount int64
+	database.DB.Model(&models.User{}).Where("role = ?", role.Name).Count(&userCount)
+	if userCount > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "角色仍有" + strconv.FormatInt(userCount, 10) + "个用户在使用，不能删除",
+		})
+		return
+	}
+
+	var childCount int64
+	database.DB.Model(&models.Role{}).Where("parent = ?", role.Name).Count(&childCount)
+	if childCount > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "角色被其他角色继承，不能删除",
+		})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", role.Name).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role = ? OR (subject_type = ? AND subject = ?)", role.Name, "role", role.Name).
+			Delete(&models.ResourceGrant{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "删除角色失败",
+		})
+		return
+	}
+
+	utils.GlobalPermissionCache.Invalidate()
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "success",
+	})
+}
+
+// GetUserEffectivePermissions 获取用户的有效权限（包含继承的权限）
+func GetUserEffectivePermissions(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的用户ID",
+		})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, uint(id)).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code": 404,
+				"msg":  "用户不存在",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "查询用户失败",
+		})
+		return
+	}
+
+	parents, err := loadRoleParents()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "查询角色失败",
+		})
+		return
+	}
+
+	permissions, err := utils.GlobalPermissionCache.EffectivePermissions(user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "查询权限失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"userId":      user.ID,
+			"role":        user.Role,
+			"roles":       utils.RoleChain(user.Role, parents),
+			"permissions": permissions,
+		},
+		"msg": "success",
+	})
+}
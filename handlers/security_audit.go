@@ -6,16 +6,14 @@ import (
 
 	"ft-backend/database"
 	"ft-backend/models"
+	"ft-backend/utils"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-// GetOperationLogs 获取操作日志列表
-func GetOperationLogs(c *gin.Context) {
-	// 解析查询参数
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+// operationLogQuery 根据查询参数构建操作日志查询，列表、导出和统计共用同一组过滤条件
+func operationLogQuery(c *gin.Context) *gorm.DB {
 	username := c.Query("username")
 	operation := c.Query("operation")
 	resource := c.Query("resource")
@@ -23,13 +21,8 @@ func GetOperationLogs(c *gin.Context) {
 	startDate := c.Query("startDate")
 	endDate := c.Query("endDate")
 
-	// 计算偏移量
-	offset := (page - 1) * pageSize
-
-	// 构建查询
 	db := database.DB.Model(&models.OperationLog{})
 
-	// 添加过滤条件
 	if username != "" {
 		db = db.Where("username LIKE ?", "%"+username+"%")
 	}
@@ -48,6 +41,20 @@ func GetOperationLogs(c *gin.Context) {
 	if endDate != "" {
 		db = db.Where("created_at <= ?", endDate)
 	}
+	return db
+}
+
+// GetOperationLogs 获取操作日志列表
+func GetOperationLogs(c *gin.Context) {
+	// 解析查询参数
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+
+	// 计算偏移量
+	offset := (page - 1) * pageSize
+
+	// 构建查询
+	db := operationLogQuery(c)
 
 	// 获取总数
 	var total int64
@@ -303,6 +310,10 @@ func UpdatePermission(c *gin.Context) {
 		})
 		return
 	}
+	recordChanges(c, existingPermission, permission)
+
+	// 权限代码可能已变更
+	utils.GlobalPermissionCache.Invalidate()
 
 	// 返回结果
 	c.JSON(http.StatusOK, gin.H{
@@ -355,6 +366,7 @@ func DeletePermission(c *gin.Context) {
 
 	// 删除关联的角色权限
 	database.DB.Where("permission_id = ?", id).Delete(&models.RolePermission{})
+	utils.GlobalPermissionCache.Invalidate()
 
 	// 返回结果
 	c.JSON(http.StatusOK, gin.H{
@@ -389,6 +401,7 @@ func BatchDeletePermissions(c *gin.Context) {
 
 	// 删除关联的角色权限
 	database.DB.Where("permission_id IN ?", request.IDs).Delete(&models.RolePermission{})
+	utils.GlobalPermissionCache.Invalidate()
 
 	// 返回结果
 	c.JSON(http.StatusOK, gin.H{
@@ -453,6 +466,14 @@ func AssignRolePermissions(c *gin.Context) {
 		return
 	}
 
+	if err := validateRole(role); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "角色不存在",
+		})
+		return
+	}
+
 	// 开始事务
 	tx := database.DB.Begin()
 	defer func() {
@@ -496,6 +517,9 @@ func AssignRolePermissions(c *gin.Context) {
 		return
 	}
 
+	// 角色权限已变更，刷新权限缓存
+	utils.GlobalPermissionCache.Invalidate()
+
 	// 返回结果
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"strconv"
 
+	"ft-backend/common/config"
+	"ft-backend/common/logger"
 	"ft-backend/database"
 	"ft-backend/models"
 	"ft-backend/utils"
@@ -94,6 +96,8 @@ func UpdateUserProfile(c *gin.Context) {
 		return
 	}
 
+	before := user
+
 	// 更新用户信息
 	if request.Phone != "" {
 		user.Phone = request.Phone
@@ -114,6 +118,7 @@ func UpdateUserProfile(c *gin.Context) {
 		})
 		return
 	}
+	recordChanges(c, before, user)
 
 	// 返回结果
 	c.JSON(http.StatusOK, gin.H{
@@ -248,6 +253,16 @@ func AddUser(c *gin.Context) {
 		return
 	}
 
+	// 校验密码强度
+	cfg := c.MustGet("config").(*config.Config)
+	if err := utils.ValidatePasswordStrength(user.Password, cfg.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  err.Error(),
+		})
+		return
+	}
+
 	// 哈希密码
 	hashedPassword, err := utils.HashPassword(user.Password)
 	if err != nil {
@@ -263,6 +278,13 @@ func AddUser(c *gin.Context) {
 	if user.Role == "" {
 		user.Role = "user"
 	}
+	if err := validateRole(user.Role); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "角色不存在",
+		})
+		return
+	}
 
 	// 保存用户
 	result = database.DB.Create(&user)
@@ -334,6 +356,8 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
+	before := user
+
 	// 更新用户信息
 	if request.Username != "" && request.Username != user.Username {
 		// 检查用户名是否已存在
@@ -379,6 +403,13 @@ func UpdateUser(c *gin.Context) {
 		user.Phone = request.Phone
 	}
 	if request.Role != "" {
+		if err := validateRole(request.Role); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code": 400,
+				"msg":  "角色不存在",
+			})
+			return
+		}
 		user.Role = request.Role
 	}
 	if request.FullName != "" {
@@ -387,28 +418,45 @@ func UpdateUser(c *gin.Context) {
 	if request.Avatar != "" {
 		user.Avatar = request.Avatar
 	}
+
+	// 保存更新，修改密码时同时校验密码策略并记录历史
 	if request.Password != "" {
-		// 哈希新密码
-		hashedPassword, err := utils.HashPassword(request.Password)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"code": 500,
-				"msg":  "密码加密失败",
+		cfg := c.MustGet("config").(*config.Config)
+		if err := validateNewPassword(&user, request.Password, cfg.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code": 400,
+				"msg":  err.Error(),
 			})
 			return
 		}
-		user.Password = hashedPassword
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			return saveNewPassword(tx, &user, request.Password, cfg.Password, user.MustChangePassword)
+		})
+	} else {
+		err = database.DB.Save(&user).Error
 	}
-
-	// 保存更新
-	result = database.DB.Save(&user)
-	if result.Error != nil {
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code": 500,
 			"msg":  "更新用户失败",
 		})
 		return
 	}
+	recordChanges(c, before, user)
+	if request.Password != "" {
+		utils.GlobalTokenRevocations.RevokeUserTokens(&user)
+	}
+
+	// 通知用户角色变更，离线时在下次连接后补发
+	if before.Role != user.Role {
+		if _, err := utils.NotifyUser(user.ID, utils.WebSocketMessage{
+			Type:    "role_changed",
+			Message: "您的角色已变更为 " + user.Role,
+			Data:    gin.H{"role": user.Role, "previous_role": before.Role},
+		}); err != nil {
+			logger.Warn("Failed to notify user %d of role change: %v", user.ID, err)
+		}
+	}
 
 	// 清除密码字段
 	user.Password = ""
@@ -563,7 +611,17 @@ func UpdateUserRole(c *gin.Context) {
 		return
 	}
 
+	// 只能设置已存在的角色
+	if err := validateRole(request.Role); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "角色不存在",
+		})
+		return
+	}
+
 	// 更新角色
+	before := user
 	user.Role = request.Role
 
 	// 保存更新
@@ -575,6 +633,7 @@ func UpdateUserRole(c *gin.Context) {
 		})
 		return
 	}
+	recordChanges(c, before, user)
 
 	// 清除密码字段
 	user.Password = ""
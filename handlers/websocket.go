@@ -2,7 +2,11 @@ package handlers
 
 import (
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
+	"ft-backend/common/config"
 	"ft-backend/common/logger"
 
 	"github.com/gin-gonic/gin"
@@ -11,26 +15,110 @@ import (
 	"ft-backend/utils"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
+// websocketTokenProtocol 通过Sec-WebSocket-Protocol传递令牌时使用的子协议名，
+// 浏览器客户端以 new WebSocket(url, ["bearer", token]) 的方式传递令牌
+const websocketTokenProtocol = "bearer"
+
+// newUpgrader 创建WebSocket升级器，只允许白名单中的来源
+func newUpgrader(allowedOrigins []string) *websocket.Upgrader {
+	upgrader := &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		Subprotocols:    []string{websocketTokenProtocol},
+	}
+	if len(allowedOrigins) > 0 {
+		upgrader.CheckOrigin = func(r *http.Request) bool {
+			return originAllowed(r.Header.Get("Origin"), allowedOrigins)
+		}
+	}
+	// 未配置白名单时使用默认的同源检查
+	return upgrader
+}
+
+// originAllowed 判断来源是否在白名单中，没有Origin头的非浏览器客户端允许连接
+func originAllowed(origin string, allowedOrigins []string) bool {
+	if origin == "" {
 		return true
-	},
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	origin = strings.ToLower(u.Scheme + "://" + u.Host)
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || strings.ToLower(strings.TrimRight(allowed, "/")) == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// websocketToken 从Sec-WebSocket-Protocol中获取令牌。不接受查询参数，避免令牌被写入访问日志
+func websocketToken(r *http.Request) string {
+	protocols := websocket.Subprotocols(r)
+	for i, protocol := range protocols {
+		if protocol == websocketTokenProtocol && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+	return ""
 }
 
-// WebSocketHandler WebSocket连接处理
+// authenticateStream 验证推送连接（WebSocket、SSE）的令牌，失败时写入错误响应
+func authenticateStream(c *gin.Context, token string) (*utils.JWTClaims, bool) {
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code": 401,
+			"msg":  "缺少访问令牌",
+		})
+		return nil, false
+	}
+
+	claims, err := utils.ValidateToken(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code": 401,
+			"msg":  "无效或已过期的令牌",
+		})
+		return nil, false
+	}
+	if claims.MustChangePassword {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code": 403,
+			"msg":  "Password change required",
+		})
+		return nil, false
+	}
+	return claims, true
+}
+
+// WebSocketHandler WebSocket连接处理，握手时验证令牌，连接身份取自令牌声明
 func WebSocketHandler(c *gin.Context) {
-	userID := c.Param("user_id")
+	cfg := c.MustGet("config").(*config.Config)
+
+	claims, ok := authenticateStream(c, websocketToken(c.Request))
+	if !ok {
+		return
+	}
 
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	// 兼容旧路径/ws/:user_id，路径中的用户ID必须与令牌一致
+	userID := strconv.FormatUint(uint64(claims.UserID), 10)
+	if pathUserID := c.Param("user_id"); pathUserID != "" && pathUserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code": 403,
+			"msg":  "不能以其他用户身份建立连接",
+		})
+		return
+	}
+
+	conn, err := newUpgrader(cfg.WebSocket.AllowedOrigins).Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		logger.Error("Failed to upgrade to WebSocket: %v", err)
 		return
 	}
 
 	// 创建新的WebSocket客户端
-	client := utils.NewWebSocketClient(userID, conn, utils.GlobalWebSocketManager)
+	client := utils.NewWebSocketClient(claims, conn, utils.GlobalWebSocketManager)
 
 	// 注册客户端
 	client.Manager.RegisterClient(client)
@@ -38,13 +126,33 @@ func WebSocketHandler(c *gin.Context) {
 	// 发送连接成功消息
 	welcomeMsg := utils.WebSocketMessage{
 		Type:    "connected",
-		UserID:  userID,
+		UserID:  client.ID,
 		Message: "WebSocket connection established",
 	}
 
-	client.Send <- utils.MustMarshalJSON(welcomeMsg)
+	client.SendMessage(welcomeMsg)
 
 	// 启动读写协程
 	go client.WritePump()
 	go client.ReadPump()
-}
\ No newline at end of file
+}
+
+// GetWebSocketPresence 获取在线用户及其WebSocket连接数
+func GetWebSocketPresence(c *gin.Context) {
+	presence := utils.GlobalWebSocketManager.Presence()
+
+	connections := 0
+	for _, user := range presence {
+		connections += user.Connections
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"list":        presence,
+			"onlineUsers": len(presence),
+			"connections": connections,
+		},
+		"msg": "success",
+	})
+}
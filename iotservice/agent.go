@@ -0,0 +1,214 @@
+package iotservice
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"ft-backend/common/config"
+	"ft-backend/common/logger"
+	"ft-backend/database"
+	"ft-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 关联机器错误
+var (
+	ErrMachineNotFound = errors.New("machine not found")
+	ErrMachineBound    = errors.New("machine is bound to another agent")
+)
+
+// heartbeatColumns 心跳时更新的代理列
+var heartbeatColumns = []string{
+	"version", "pid", "status", "local_ip", "hostname", "os_info", "business_module",
+	"task_count", "task_left", "last_task_at", "suggested_machine_id", "last_seen_at",
+}
+
+// RecordHeartbeat 更新已认证代理的心跳信息，写入心跳历史和各主机的性能数据
+func RecordHeartbeat(agent *models.Agent, heartbeat ClientHeartbeat) error {
+	now := time.Now()
+	hosts, err := json.Marshal(append([]HostInfo{heartbeat.PrimaryHost}, heartbeat.SecondaryHosts...))
+	if err != nil {
+		return err
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		agent.Version = heartbeat.ClientVersion
+		agent.PID = heartbeat.PID
+		agent.Status = heartbeat.Status
+		agent.LocalIP = heartbeat.LocalIP
+		agent.Hostname = heartbeat.PrimaryHost.Hostname
+		agent.OSInfo = heartbeat.PrimaryHost.OSInfo
+		agent.BusinessModule = heartbeat.BusinessModule
+		agent.TaskCount = heartbeat.TaskCount
+		agent.TaskLeft = heartbeat.TaskLeft
+		agent.LastTaskAt = nil
+		if heartbeat.LastTaskTime > 0 {
+			lastTaskAt := time.UnixMilli(heartbeat.LastTaskTime)
+			agent.LastTaskAt = &lastTaskAt
+		}
+		agent.LastSeenAt = now
+
+		// 上报的IP/主机名不可信，匹配结果只作为建议，由管理员确认关联
+		if machineID, ok := matchMachine(tx, heartbeat); ok {
+			agent.SuggestedMachineID = &machineID
+		} else {
+			agent.SuggestedMachineID = nil
+		}
+
+		// 只更新心跳相关的列，避免覆盖并发轮换的密钥
+		if err := tx.Model(agent).Select(heartbeatColumns).Updates(agent).Error; err != nil {
+			return err
+		}
+
+		sample := models.AgentHeartbeat{
+			AgentID:    agent.ID,
+			ReceivedAt: now,
+			ReportedAt: now,
+			Version:    heartbeat.ClientVersion,
+			Status:     heartbeat.Status,
+			TaskCount:  heartbeat.TaskCount,
+			TaskLeft:   heartbeat.TaskLeft,
+			Hosts:      hosts,
+		}
+		if heartbeat.HeartbeatTime > 0 {
+			sample.ReportedAt = time.UnixMilli(heartbeat.HeartbeatTime)
+		}
+		if err := tx.Create(&sample).Error; err != nil {
+			return err
+		}
+
+		return recordPerformance(tx, agent, heartbeat, sample.ReportedAt)
+	})
+}
+
+// matchMachine 按主机IP、本地IP、副主机IP的顺序匹配机器，都不匹配时按主机名匹配机器名称
+func matchMachine(tx *gorm.DB, heartbeat ClientHeartbeat) (uint, bool) {
+	var ips []string
+	for _, ip := range []string{heartbeat.PrimaryHost.IP, heartbeat.LocalIP} {
+		if ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+	for _, host := range heartbeat.SecondaryHosts {
+		if host.IP != "" {
+			ips = append(ips, host.IP)
+		}
+	}
+
+	for _, ip := range ips {
+		if machine, ok := findMachine(tx, ip, ""); ok {
+			return machine.ID, true
+		}
+	}
+	if machine, ok := findMachine(tx, "", heartbeat.PrimaryHost.Hostname); ok {
+		return machine.ID, true
+	}
+	return 0, false
+}
+
+// findMachine 按IP查找未删除的机器，IP不匹配时按主机名匹配机器名称
+func findMachine(tx *gorm.DB, ip, hostname string) (*models.Machine, bool) {
+	var machine models.Machine
+	if ip != "" {
+		if err := tx.Where("ip = ? AND deleted_at IS NULL", ip).First(&machine).Error; err == nil {
+			return &machine, true
+		}
+	}
+	if hostname != "" {
+		if err := tx.Where("name = ? AND deleted_at IS NULL", hostname).First(&machine).Error; err == nil {
+			return &machine, true
+		}
+	}
+	return nil, false
+}
+
+// LinkMachine 管理员确认代理与机器的关联。锁定机器行后检查，一台机器只能关联一个未吊销的代理
+func LinkMachine(agent *models.Agent, machineID uint, operator string) error {
+	now := time.Now()
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var machine models.Machine
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("deleted_at IS NULL").First(&machine, machineID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrMachineNotFound
+			}
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.Agent{}).
+			Where("machine_id = ? AND id <> ? AND revoked_at IS NULL", machineID, agent.ID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrMachineBound
+		}
+
+		return tx.Model(agent).Updates(map[string]interface{}{
+			"machine_id":        machineID,
+			"machine_linked_at": now,
+			"machine_linked_by": operator,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+	agent.MachineID = &machineID
+	agent.MachineLinkedAt = &now
+	agent.MachineLinkedBy = operator
+	return nil
+}
+
+// UnlinkMachine 解除代理与机器的关联
+func UnlinkMachine(agent *models.Agent) error {
+	if err := database.DB.Model(agent).Updates(map[string]interface{}{
+		"machine_id":        nil,
+		"machine_linked_at": nil,
+		"machine_linked_by": "",
+	}).Error; err != nil {
+		return err
+	}
+	agent.MachineID = nil
+	agent.MachineLinkedAt = nil
+	agent.MachineLinkedBy = ""
+	return nil
+}
+
+// StartHeartbeatRetention 每小时清理超过保留天数的心跳历史、心跳生成的性能数据和过期的签名nonce，保留天数为0时不清理对应数据
+func StartHeartbeatRetention(cfg config.AgentConfig) {
+	logger.Info("Agent data retention started, keep heartbeats %d days, performance data %d days", cfg.HeartbeatRetentionDays, cfg.PerformanceRetentionDays)
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if cfg.HeartbeatRetentionDays > 0 {
+			before := time.Now().AddDate(0, 0, -cfg.HeartbeatRetentionDays)
+			result := database.DB.Where("received_at < ?", before).Delete(&models.AgentHeartbeat{})
+			if result.Error != nil {
+				logger.Error("清理心跳历史失败: %v", result.Error)
+			} else if result.RowsAffected > 0 {
+				logger.Info("Deleted %d agent heartbeats", result.RowsAffected)
+			}
+		}
+
+		if cfg.PerformanceRetentionDays > 0 {
+			before := time.Now().AddDate(0, 0, -cfg.PerformanceRetentionDays)
+			result := database.DB.Where("source = ? AND timestamp < ?", PerformanceSourceHeartbeat, before).Delete(&models.PerformanceData{})
+			if result.Error != nil {
+				logger.Error("清理性能数据失败: %v", result.Error)
+			} else if result.RowsAffected > 0 {
+				logger.Info("Deleted %d performance samples", result.RowsAffected)
+			}
+		}
+
+		// 过期的nonce已不可能通过时间戳检查，直接删除
+		if err := database.DB.Where("expires_at < ?", time.Now()).Delete(&models.AgentNonce{}).Error; err != nil {
+			logger.Error("清理过期nonce失败: %v", err)
+		}
+		<-ticker.C
+	}
+}
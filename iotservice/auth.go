@@ -0,0 +1,320 @@
+package iotservice
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ft-backend/common/config"
+	"ft-backend/common/logger"
+	"ft-backend/database"
+	"ft-backend/models"
+	"ft-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 代理请求签名相关的请求头，签名算法见utils.SignAgentRequest
+const (
+	HeaderAgentID   = "X-Agent-ID"
+	HeaderTimestamp = "X-Timestamp" // Unix秒
+	HeaderNonce     = "X-Nonce"
+	HeaderSignature = "X-Signature"
+)
+
+// maxAgentBodySize 代理请求体的最大长度
+const maxAgentBodySize = 1 << 20
+
+// errNonceUsed nonce已被使用
+var errNonceUsed = errors.New("nonce already used")
+
+// clientConfig 获取客户端接入配置
+func clientConfig(c *gin.Context) config.ClientConfig {
+	return withClientDefaults(c.MustGet("config").(*config.Config).Client)
+}
+
+// withClientDefaults 未配置的项使用默认值
+func withClientDefaults(cfg config.ClientConfig) config.ClientConfig {
+	if cfg.SignatureWindow <= 0 {
+		cfg.SignatureWindow = 300
+	}
+	if cfg.SecretGracePeriod <= 0 {
+		cfg.SecretGracePeriod = 600
+	}
+	return cfg
+}
+
+// signedRequest 代理签名请求
+type signedRequest struct {
+	utils.AgentSignedRequest
+	signature string
+}
+
+// readSignedRequest 读取签名请求头和请求体，检查时间戳是否在允许的窗口内，并恢复请求体供后续绑定
+func readSignedRequest(c *gin.Context, window time.Duration) (*signedRequest, error) {
+	request := &signedRequest{
+		AgentSignedRequest: utils.AgentSignedRequest{
+			Method:    c.Request.Method,
+			URI:       c.Request.URL.RequestURI(),
+			AgentID:   c.GetHeader(HeaderAgentID),
+			Timestamp: c.GetHeader(HeaderTimestamp),
+			Nonce:     c.GetHeader(HeaderNonce),
+		},
+		signature: c.GetHeader(HeaderSignature),
+	}
+	if request.Timestamp == "" || request.Nonce == "" || request.signature == "" {
+		return nil, errors.New("missing signature headers")
+	}
+	if len(request.Nonce) < 8 || len(request.Nonce) > 64 {
+		return nil, errors.New("invalid nonce")
+	}
+
+	seconds, err := strconv.ParseInt(request.Timestamp, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid timestamp")
+	}
+	skew := time.Since(time.Unix(seconds, 0))
+	if skew > window || skew < -window {
+		return nil, errors.New("timestamp outside allowed window")
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxAgentBodySize))
+	if err != nil {
+		return nil, errors.New("failed to read request body")
+	}
+	request.Body = body
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return request, nil
+}
+
+// useNonce 记录nonce，签名窗口内重复使用时返回errNonceUsed。
+// 直接插入并依赖唯一索引判断重复，并发重放的请求只有一个能成功
+func useNonce(agentID uint, nonce string, window time.Duration) error {
+	// 时间戳可以在当前时间前后各偏差一个窗口，nonce需要保留两个窗口
+	err := database.DB.Create(&models.AgentNonce{
+		AgentID:   agentID,
+		Nonce:     nonce,
+		ExpiresAt: time.Now().Add(2 * window),
+	}).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return errNonceUsed
+	}
+	return err
+}
+
+// agentSecrets 返回代理当前有效的密钥，轮换宽限期内包含旧密钥
+func agentSecrets(agent *models.Agent, encryptKey string) []string {
+	var secrets []string
+	if secret, err := utils.DecryptAgentSecret(encryptKey, agent.SecretCipher); err == nil {
+		secrets = append(secrets, secret)
+	}
+	if agent.PreviousSecretCipher != "" && agent.PreviousSecretExpiresAt != nil && agent.PreviousSecretExpiresAt.After(time.Now()) {
+		if secret, err := utils.DecryptAgentSecret(encryptKey, agent.PreviousSecretCipher); err == nil {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
+// AgentAuth 验证代理请求的HMAC签名，拒绝未注册、已吊销的代理和重放的请求，验证通过后将代理存入上下文
+func AgentAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := clientConfig(c)
+		window := time.Duration(cfg.SignatureWindow) * time.Second
+
+		agentID, err := strconv.ParseUint(c.GetHeader(HeaderAgentID), 10, 32)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing or invalid agent id"})
+			return
+		}
+
+		request, err := readSignedRequest(c, window)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		var agent models.Agent
+		if err := database.DB.First(&agent, uint(agentID)).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unknown agent"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "query agent failed"})
+			return
+		}
+		if agent.RevokedAt != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "agent revoked"})
+			return
+		}
+
+		verified := false
+		for _, secret := range agentSecrets(&agent, cfg.EncryptKey) {
+			if utils.VerifyAgentSignature(secret, request.AgentSignedRequest, request.signature) {
+				verified = true
+				break
+			}
+		}
+		if !verified {
+			logger.Warn("Invalid signature from agent %d (%s)", agent.ID, c.ClientIP())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid signature"})
+			return
+		}
+
+		if err := useNonce(agent.ID, request.Nonce, window); err != nil {
+			if errors.Is(err, errNonceUsed) {
+				logger.Warn("Replayed request from agent %d (%s)", agent.ID, c.ClientIP())
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "record nonce failed"})
+			return
+		}
+
+		c.Set("agent", &agent)
+		c.Next()
+	}
+}
+
+// EnrollAgent 代理注册，请求使用client.encrypt_key签名（不带X-Agent-ID），返回代理ID和签名密钥。
+// encrypt_key短于utils.MinEnrollKeyLength时禁止注册。密钥只在响应中返回一次，已注册或已吊销的代理不能重复注册
+func EnrollAgent(c *gin.Context) {
+	cfg := clientConfig(c)
+	if len(cfg.EncryptKey) < utils.MinEnrollKeyLength {
+		c.JSON(http.StatusForbidden, gin.H{"error": "enrollment disabled"})
+		return
+	}
+	window := time.Duration(cfg.SignatureWindow) * time.Second
+
+	request, err := readSignedRequest(c, window)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if request.AgentID != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "enrollment must not carry an agent id"})
+		return
+	}
+	if !utils.VerifyAgentSignature(cfg.EncryptKey, request.AgentSignedRequest, request.signature) {
+		logger.Warn("Invalid enrollment signature from %s", c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid signature"})
+		return
+	}
+	if err := useNonce(0, request.Nonce, window); err != nil {
+		if errors.Is(err, errNonceUsed) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "record nonce failed"})
+		return
+	}
+
+	var enrollment struct {
+		ClientID string `json:"client_id"`
+	}
+	if err := json.Unmarshal(request.Body, &enrollment); err != nil || enrollment.ClientID == "" || len(enrollment.ClientID) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "client_id is required"})
+		return
+	}
+
+	secret, err := utils.GenerateAgentSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "generate secret failed"})
+		return
+	}
+	encrypted, err := utils.EncryptAgentSecret(cfg.EncryptKey, secret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "encrypt secret failed"})
+		return
+	}
+
+	var agent models.Agent
+	result := database.DB.Where("client_id = ?", enrollment.ClientID).First(&agent)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query agent failed"})
+		return
+	}
+	if result.Error == nil {
+		if agent.RevokedAt != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "agent revoked"})
+			return
+		}
+		if agent.SecretCipher != "" {
+			c.JSON(http.StatusConflict, gin.H{"error": "agent already enrolled"})
+			return
+		}
+	}
+
+	// 注册前通过未签名心跳创建的代理记录直接补发密钥
+	now := time.Now()
+	if result.Error != nil {
+		agent = models.Agent{ClientID: enrollment.ClientID, FirstSeenAt: now, LastSeenAt: now}
+	}
+	agent.SecretCipher = encrypted
+	agent.EnrolledAt = &now
+	if err := database.DB.Save(&agent).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "save agent failed"})
+		return
+	}
+
+	logger.Info("Agent %d enrolled: %s (%s)", agent.ID, agent.ClientID, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{
+		"agent_id": agent.ID,
+		"secret":   secret,
+	})
+}
+
+// RotateSecret 为代理生成新密钥，旧密钥在宽限期内仍可用于签名
+func RotateSecret(agent *models.Agent, cfg config.ClientConfig) (string, error) {
+	cfg = withClientDefaults(cfg)
+	secret, err := utils.GenerateAgentSecret()
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := utils.EncryptAgentSecret(cfg.EncryptKey, secret)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	previousExpiresAt := now.Add(time.Duration(cfg.SecretGracePeriod) * time.Second)
+	updates := map[string]interface{}{
+		"secret_cipher":              encrypted,
+		"previous_secret_cipher":     agent.SecretCipher,
+		"previous_secret_expires_at": previousExpiresAt,
+		"secret_rotated_at":          now,
+	}
+	if err := database.DB.Model(agent).Updates(updates).Error; err != nil {
+		return "", err
+	}
+	agent.PreviousSecretCipher = agent.SecretCipher
+	agent.PreviousSecretExpiresAt = &previousExpiresAt
+	agent.SecretCipher = encrypted
+	agent.SecretRotatedAt = &now
+	return secret, nil
+}
+
+// RotateAgentSecret 代理使用当前密钥签名请求轮换密钥，返回新密钥
+func RotateAgentSecret(c *gin.Context) {
+	agent := c.MustGet("agent").(*models.Agent)
+	cfg := clientConfig(c)
+
+	secret, err := RotateSecret(agent, cfg)
+	if err != nil {
+		logger.Error("rotate agent secret error:%v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "rotate secret failed"})
+		return
+	}
+
+	logger.Info("Agent %d rotated its secret", agent.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"agent_id":                   agent.ID,
+		"secret":                     secret,
+		"previous_secret_expires_at": agent.PreviousSecretExpiresAt,
+	})
+}
@@ -1,7 +1,9 @@
 package iotservice
 
 import (
+	"ft-backend/common/config"
 	"ft-backend/common/logger"
+	"ft-backend/models"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -45,5 +47,29 @@ func HeatbeatCheck(c *gin.Context) {
 		return
 	}
 	logger.Debug("get client info:%v", clientInfo)
-	c.JSON(http.StatusOK, gin.H{"message": "pong"})
+
+	// 心跳中的client_id必须与签名的代理一致
+	agent := c.MustGet("agent").(*models.Agent)
+	if clientInfo.ClientID != agent.ClientID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "client_id does not match agent"})
+		return
+	}
+	if err := RecordHeartbeat(agent, clientInfo); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "record heartbeat failed"})
+		logger.Error("record heartbeat error:%v", err)
+		return
+	}
+
+	// 在心跳响应中下发等待执行的任务
+	tasks, err := DispatchTasks(agent.ID, c.MustGet("config").(*config.Config).Agent.TasksPerHeartbeat)
+	if err != nil {
+		logger.Error("dispatch agent tasks error:%v", err)
+	}
+
+	// 代理所在分组的灰度策略选中该代理时返回升级指令
+	upgrade, err := CheckUpgrade(agent)
+	if err != nil {
+		logger.Error("check agent upgrade error:%v", err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "pong", "tasks": tasks, "upgrade": upgrade})
 }
@@ -0,0 +1,109 @@
+package iotservice
+
+import (
+	"time"
+
+	"ft-backend/common/logger"
+	"ft-backend/models"
+	"ft-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// PerformanceSourceHeartbeat 由客户端心跳生成的性能数据
+const PerformanceSourceHeartbeat = "heartbeat"
+
+// gib 机器配置中内存、磁盘容量的单位（GB）换算为字节
+const gib = 1 << 30
+
+// recordPerformance 将心跳中的指标写入性能数据。上报的IP/主机名不可信：
+// 主主机只写入管理员确认关联的机器；副主机按IP/主机名匹配，但不写入已关联其他未吊销代理的机器
+func recordPerformance(tx *gorm.DB, agent *models.Agent, heartbeat ClientHeartbeat, timestamp time.Time) error {
+	seen := make(map[uint]bool, len(heartbeat.SecondaryHosts)+1)
+	var rows []models.PerformanceData
+
+	if agent.MachineID != nil {
+		var linked models.Machine
+		if err := tx.Where("deleted_at IS NULL").First(&linked, *agent.MachineID).Error; err == nil {
+			seen[linked.ID] = true
+			rows = append(rows, hostPerformance(linked, heartbeat.PrimaryHost, timestamp))
+		}
+	}
+
+	for _, host := range heartbeat.SecondaryHosts {
+		machine, ok := findMachine(tx, host.IP, host.Hostname)
+		// 多个主机匹配到同一台机器时只记录第一个
+		if !ok || seen[machine.ID] {
+			continue
+		}
+		seen[machine.ID] = true
+
+		bound, err := boundToOtherAgent(tx, machine.ID, agent.ID)
+		if err != nil {
+			return err
+		}
+		if bound {
+			logger.Warn("Agent %d reported secondary host %s bound to another agent, ignored", agent.ID, host.IP)
+			continue
+		}
+		rows = append(rows, hostPerformance(*machine, host, timestamp))
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+	return tx.Create(&rows).Error
+}
+
+// boundToOtherAgent 机器是否已关联其他未吊销的代理
+func boundToOtherAgent(tx *gorm.DB, machineID, agentID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&models.Agent{}).
+		Where("machine_id = ? AND id <> ? AND revoked_at IS NULL", machineID, agentID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// hostPerformance 将主机指标换算为性能数据，机器填写了内存、磁盘容量时换算为使用率百分比
+func hostPerformance(machine models.Machine, host HostInfo, timestamp time.Time) models.PerformanceData {
+	data := models.PerformanceData{
+		MachineID:    machine.ID,
+		MachineName:  machine.Name,
+		CPUUsage:     clampPercent(host.CPUUsage),
+		NetworkDelay: host.NetworkDelay,
+		MemoryBytes:  host.MemoryUsage,
+		HostIP:       host.IP,
+		Source:       PerformanceSourceHeartbeat,
+		Timestamp:    timestamp,
+	}
+
+	if machine.Memory > 0 && host.MemoryUsage > 0 {
+		data.MemoryUsage = clampPercent(float64(host.MemoryUsage) / (float64(machine.Memory) * gib) * 100)
+	}
+
+	// 上报的是磁盘可用空间，使用率 = (容量 - 可用) / 容量
+	if host.DiskUsage != "" {
+		free, err := utils.ParseByteSize(host.DiskUsage)
+		if err != nil {
+			logger.Debug("Ignore disk usage %q of host %s: %v", host.DiskUsage, host.IP, err)
+		} else {
+			data.DiskFreeBytes = free
+			if machine.Disk > 0 {
+				capacity := float64(machine.Disk) * gib
+				data.DiskUsage = clampPercent((capacity - float64(free)) / capacity * 100)
+			}
+		}
+	}
+	return data
+}
+
+// clampPercent 将百分比限制在0-100之间
+func clampPercent(value float64) float64 {
+	if value < 0 {
+		return 0
+	}
+	if value > 100 {
+		return 100
+	}
+	return value
+}
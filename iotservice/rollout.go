@@ -0,0 +1,178 @@
+package iotservice
+
+import (
+	"errors"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"strconv"
+
+	"ft-backend/common/logger"
+	"ft-backend/database"
+	"ft-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UpgradeInstruction 心跳响应中的升级指令，代理通过签名请求从URL下载安装包并校验Checksum
+type UpgradeInstruction struct {
+	ReleaseID uint   `json:"release_id"`
+	Version   string `json:"version"`
+	URL       string `json:"url"`
+	Checksum  string `json:"checksum"`
+	Size      int64  `json:"size"`
+}
+
+// RolloutProgress 分组灰度进度
+type RolloutProgress struct {
+	models.AgentRolloutPolicy
+	Total    int            `json:"total"`    // 分组内的代理数
+	Targeted int            `json:"targeted"` // 按当前比例选中的代理数
+	Upgraded int            `json:"upgraded"` // 已运行目标版本的代理数
+	Pending  int            `json:"pending"`  // 已选中但尚未升级的代理数
+	Versions map[string]int `json:"versions"` // 分组内各版本的代理数
+}
+
+// rolloutBucket 按client_id和目标版本计算0-99的分桶，同一版本提高比例时已选中的代理保持选中
+func rolloutBucket(clientID, version string) int {
+	h := fnv.New32a()
+	h.Write([]byte(clientID + "|" + version))
+	return int(h.Sum32() % 100)
+}
+
+// inRollout 代理是否在灰度范围内
+func inRollout(clientID string, policy *models.AgentRolloutPolicy) bool {
+	return !policy.Paused && rolloutBucket(clientID, policy.Version) < policy.Percentage
+}
+
+// releaseArtifactURL 代理下载安装包的地址
+func releaseArtifactURL(releaseID uint) string {
+	return "/api/v1/agent-releases/" + strconv.FormatUint(uint64(releaseID), 10) + "/artifact"
+}
+
+// CheckUpgrade 根据代理关联机器所在分组的版本策略判断是否需要升级，不需要时返回nil。
+// 未关联机器的代理不参与灰度
+func CheckUpgrade(agent *models.Agent) (*UpgradeInstruction, error) {
+	if agent.MachineID == nil {
+		return nil, nil
+	}
+
+	var machine models.Machine
+	if err := database.DB.Select("id", "group_name").Where("deleted_at IS NULL").First(&machine, *agent.MachineID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var policy models.AgentRolloutPolicy
+	if err := database.DB.Where("group_name = ?", machine.GroupName).First(&policy).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if policy.Version == agent.Version || !inRollout(agent.ClientID, &policy) {
+		return nil, nil
+	}
+
+	var release models.AgentRelease
+	if err := database.DB.Where("version = ?", policy.Version).First(&release).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &UpgradeInstruction{
+		ReleaseID: release.ID,
+		Version:   release.Version,
+		URL:       releaseArtifactURL(release.ID),
+		Checksum:  release.Checksum,
+		Size:      release.Size,
+	}, nil
+}
+
+// GetRolloutProgress 统计各分组策略的灰度进度，只统计未吊销且关联了未删除机器的代理
+func GetRolloutProgress() ([]RolloutProgress, error) {
+	var policies []models.AgentRolloutPolicy
+	if err := database.DB.Order("group_name ASC").Find(&policies).Error; err != nil {
+		return nil, err
+	}
+
+	var agents []struct {
+		ClientID  string
+		Version   string
+		GroupName string
+	}
+	if err := database.DB.Table("agents").
+		Select("agents.client_id, agents.version, machines.group_name").
+		Joins("JOIN machines ON machines.id = agents.machine_id AND machines.deleted_at IS NULL").
+		Where("agents.revoked_at IS NULL").
+		Scan(&agents).Error; err != nil {
+		return nil, err
+	}
+
+	progress := make([]RolloutProgress, 0, len(policies))
+	for i := range policies {
+		policy := &policies[i]
+		item := RolloutProgress{AgentRolloutPolicy: *policy, Versions: map[string]int{}}
+		for _, agent := range agents {
+			if agent.GroupName != policy.GroupName {
+				continue
+			}
+			item.Total++
+			item.Versions[agent.Version]++
+			upgraded := agent.Version == policy.Version
+			if upgraded {
+				item.Upgraded++
+			}
+			if rolloutBucket(agent.ClientID, policy.Version) < policy.Percentage {
+				item.Targeted++
+				if !upgraded {
+					item.Pending++
+				}
+			}
+		}
+		progress = append(progress, item)
+	}
+	return progress, nil
+}
+
+// DownloadReleaseArtifact 代理下载发布版本的安装包，响应头X-Checksum为安装包的SHA-256
+func DownloadReleaseArtifact(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid release id"})
+		return
+	}
+
+	var release models.AgentRelease
+	if err := database.DB.First(&release, uint(id)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "release not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query release failed"})
+		return
+	}
+
+	var file models.File
+	if err := database.DB.Where("id = ? AND status = ?", release.FileID, "available").First(&file).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "release artifact not found"})
+		return
+	}
+	if _, err := os.Stat(file.Path); err != nil {
+		logger.Error("release artifact missing: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "release artifact not found"})
+		return
+	}
+
+	agent := c.MustGet("agent").(*models.Agent)
+	logger.Info("Agent %d downloading release %s", agent.ID, release.Version)
+
+	c.Header("Content-Disposition", "attachment; filename="+file.OriginalName)
+	c.Header("X-Checksum", release.Checksum)
+	c.File(file.Path)
+}
@@ -0,0 +1,79 @@
+package iotservice
+
+import (
+	"fmt"
+	"testing"
+
+	"ft-backend/models"
+)
+
+func TestRolloutBucket(t *testing.T) {
+	tests := []struct {
+		clientID string
+		version  string
+	}{
+		{clientID: "agent-001", version: "1.2.0"},
+		{clientID: "agent-001", version: "1.3.0"},
+		{clientID: "", version: "1.2.0"},
+		{clientID: "host-a.example.com", version: ""},
+	}
+	for _, tt := range tests {
+		bucket := rolloutBucket(tt.clientID, tt.version)
+		if bucket < 0 || bucket >= 100 {
+			t.Errorf("rolloutBucket(%q, %q) = %d, want 0-99", tt.clientID, tt.version, bucket)
+		}
+		if again := rolloutBucket(tt.clientID, tt.version); again != bucket {
+			t.Errorf("rolloutBucket(%q, %q) not stable: %d != %d", tt.clientID, tt.version, again, bucket)
+		}
+	}
+}
+
+func TestInRolloutRaisingPercentage(t *testing.T) {
+	const agents = 1000
+	clientIDs := make([]string, agents)
+	for i := range clientIDs {
+		clientIDs[i] = fmt.Sprintf("agent-%04d", i)
+	}
+
+	policy := &models.AgentRolloutPolicy{Version: "2.0.0"}
+	selected := make(map[string]bool)
+	for _, percentage := range []int{0, 1, 5, 10, 25, 50, 90, 100} {
+		policy.Percentage = percentage
+		count := 0
+		for _, clientID := range clientIDs {
+			in := inRollout(clientID, policy)
+			// 提高比例时已选中的代理必须保持选中
+			if selected[clientID] && !in {
+				t.Fatalf("%s dropped out of rollout when raising to %d%%", clientID, percentage)
+			}
+			if in {
+				selected[clientID] = true
+				count++
+			}
+		}
+
+		switch percentage {
+		case 0:
+			if count != 0 {
+				t.Errorf("0%%: %d agents selected, want 0", count)
+			}
+		case 100:
+			if count != agents {
+				t.Errorf("100%%: %d agents selected, want %d", count, agents)
+			}
+		default:
+			// 分桶大致均匀，允许较大的偏差避免测试不稳定
+			want := agents * percentage / 100
+			if count < want/2 || count > want*3/2+10 {
+				t.Errorf("%d%%: %d agents selected, want about %d", percentage, count, want)
+			}
+		}
+	}
+}
+
+func TestInRolloutPaused(t *testing.T) {
+	policy := &models.AgentRolloutPolicy{Version: "2.0.0", Percentage: 100, Paused: true}
+	if inRollout("agent-0001", policy) {
+		t.Error("paused rollout selected an agent")
+	}
+}
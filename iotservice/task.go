@@ -0,0 +1,327 @@
+package iotservice
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ft-backend/common/logger"
+	"ft-backend/database"
+	"ft-backend/models"
+	"ft-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 代理任务类型
+const (
+	TaskRunScript    = "run_script"
+	TaskCollectLogs  = "collect_logs"
+	TaskUpgradeAgent = "upgrade_agent"
+	TaskUpdateConfig = "update_config"
+)
+
+// 代理任务状态：pending等待下发，dispatched已在心跳响应中下发，running代理已确认，其余为终态
+const (
+	TaskPending    = "pending"
+	TaskDispatched = "dispatched"
+	TaskRunning    = "running"
+	TaskSucceeded  = "succeeded"
+	TaskFailed     = "failed"
+	TaskTimedOut   = "timeout"
+	TaskCanceled   = "canceled"
+)
+
+// maxTaskOutput 保存的任务输出最大长度，超出时保留末尾部分
+const maxTaskOutput = 64 << 10
+
+// 任务状态转换错误
+var (
+	ErrTaskNotFound     = errors.New("task not found")
+	ErrTaskStateChanged = errors.New("task state changed")
+)
+
+// DispatchedTask 心跳响应中下发给代理的任务
+type DispatchedTask struct {
+	ID      uint            `json:"id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+	Timeout int             `json:"timeout"`
+	Attempt int             `json:"attempt"` // 上报结果时原样带回，过期的执行结果会被拒绝
+}
+
+// TaskResult 代理上报的任务状态，status为running时表示确认收到并开始执行
+type TaskResult struct {
+	Attempt  int    `json:"attempt" binding:"required,min=1"` // 下发时的attempt，与当前下发次数不一致时拒绝
+	Status   string `json:"status"`
+	ExitCode *int   `json:"exit_code"`
+	Output   string `json:"output"`
+	Error    string `json:"error"`
+}
+
+// ValidTaskType 检查任务类型是否支持
+func ValidTaskType(taskType string) bool {
+	switch taskType {
+	case TaskRunScript, TaskCollectLogs, TaskUpgradeAgent, TaskUpdateConfig:
+		return true
+	}
+	return false
+}
+
+// TaskFinished 任务是否处于终态
+func TaskFinished(status string) bool {
+	switch status {
+	case TaskSucceeded, TaskFailed, TaskTimedOut, TaskCanceled:
+		return true
+	}
+	return false
+}
+
+// DispatchTasks 领取代理等待下发的任务，标记为dispatched并计算截止时间。
+// 按状态条件更新，多实例同时处理同一代理的心跳时每个任务只会下发一次
+func DispatchTasks(agentID uint, limit int) ([]DispatchedTask, error) {
+	if limit <= 0 {
+		limit = 5
+	}
+
+	var pending []models.AgentTask
+	if err := database.DB.Where("agent_id = ? AND status = ?", agentID, TaskPending).
+		Order("id ASC").Limit(limit).Find(&pending).Error; err != nil {
+		return nil, err
+	}
+
+	tasks := make([]DispatchedTask, 0, len(pending))
+	for _, task := range pending {
+		now := time.Now()
+		deadline := now.Add(time.Duration(task.Timeout) * time.Second)
+		result := database.DB.Model(&models.AgentTask{}).
+			Where("id = ? AND status = ?", task.ID, TaskPending).
+			Updates(map[string]interface{}{
+				"status":        TaskDispatched,
+				"attempts":      gorm.Expr("attempts + 1"),
+				"dispatched_at": now,
+				"acked_at":      nil,
+				"deadline_at":   deadline,
+			})
+		if result.Error != nil {
+			return tasks, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		task.Status = TaskDispatched
+		task.Attempts++
+		task.DispatchedAt = &now
+		task.AckedAt = nil
+		task.DeadlineAt = &deadline
+		publishTaskUpdate(&task)
+
+		tasks = append(tasks, DispatchedTask{
+			ID:      task.ID,
+			Type:    task.Type,
+			Payload: task.Payload,
+			Timeout: task.Timeout,
+			Attempt: task.Attempts,
+		})
+	}
+	return tasks, nil
+}
+
+// ReportTaskResult 代理上报任务状态和结果，只接受本代理当前这次下发的任务。
+// 失败的任务在重试次数内重新排队
+func ReportTaskResult(c *gin.Context) {
+	agent := c.MustGet("agent").(*models.Agent)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid task id"})
+		return
+	}
+
+	var result TaskResult
+	if err := c.ShouldBindJSON(&result); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	task, err := applyTaskResult(agent.ID, uint(id), result)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTaskNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrTaskStateChanged):
+			// 任务已超时、取消或重新下发，代理应停止执行
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			logger.Error("report task result error:%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "update task failed"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": task.ID, "status": task.Status})
+}
+
+// applyTaskResult 按代理上报的状态更新任务
+func applyTaskResult(agentID, taskID uint, result TaskResult) (*models.AgentTask, error) {
+	var task models.AgentTask
+	if err := database.DB.Where("id = ? AND agent_id = ?", taskID, agentID).First(&task).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTaskNotFound
+		}
+		return nil, err
+	}
+	// 旧的下发次数上报的结果不能覆盖重试后的执行
+	if result.Attempt != task.Attempts {
+		return nil, ErrTaskStateChanged
+	}
+
+	now := time.Now()
+	var updates map[string]interface{}
+	var from []string
+	switch result.Status {
+	case TaskRunning:
+		from = []string{TaskDispatched}
+		updates = map[string]interface{}{"status": TaskRunning, "acked_at": now}
+
+	case TaskSucceeded, TaskFailed:
+		from = []string{TaskDispatched, TaskRunning}
+		status := result.Status
+		finishedAt := &now
+		if status == TaskFailed && task.Attempts <= task.MaxRetries {
+			status = TaskPending
+			finishedAt = nil
+		}
+		updates = map[string]interface{}{
+			"status":      status,
+			"exit_code":   result.ExitCode,
+			"output":      truncateOutput(result.Output),
+			"error":       result.Error,
+			"deadline_at": nil,
+			"finished_at": finishedAt,
+		}
+
+	default:
+		return nil, errors.New("invalid task status")
+	}
+
+	update := database.DB.Model(&models.AgentTask{}).
+		Where("id = ? AND attempts = ? AND status IN ?", task.ID, result.Attempt, from).
+		Updates(updates)
+	if update.Error != nil {
+		return nil, update.Error
+	}
+	if update.RowsAffected == 0 {
+		return nil, ErrTaskStateChanged
+	}
+
+	if err := database.DB.First(&task, task.ID).Error; err != nil {
+		return nil, err
+	}
+	publishTaskUpdate(&task)
+	return &task, nil
+}
+
+// truncateOutput 截断过长的输出，保留末尾部分
+func truncateOutput(output string) string {
+	if len(output) <= maxTaskOutput {
+		return output
+	}
+	return "...(truncated)\n" + output[len(output)-maxTaskOutput:]
+}
+
+// CancelTask 取消未结束的任务，已下发的任务在代理上报结果时会收到409
+func CancelTask(task *models.AgentTask) (bool, error) {
+	now := time.Now()
+	result := database.DB.Model(&models.AgentTask{}).
+		Where("id = ? AND status IN ?", task.ID, []string{TaskPending, TaskDispatched, TaskRunning}).
+		Updates(map[string]interface{}{
+			"status":      TaskCanceled,
+			"deadline_at": nil,
+			"finished_at": now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	task.Status = TaskCanceled
+	task.DeadlineAt = nil
+	task.FinishedAt = &now
+	publishTaskUpdate(task)
+	return true, nil
+}
+
+// StartTaskTimeoutMonitor 每30秒检查超过截止时间的任务，重试次数内重新排队，否则标记为超时
+func StartTaskTimeoutMonitor() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	logger.Info("Agent task timeout monitor started")
+
+	for range ticker.C {
+		checkTaskTimeouts()
+	}
+}
+
+// checkTaskTimeouts 处理超时的任务
+func checkTaskTimeouts() {
+	var expired []models.AgentTask
+	if err := database.DB.Where("status IN ? AND deadline_at < ?", []string{TaskDispatched, TaskRunning}, time.Now()).
+		Find(&expired).Error; err != nil {
+		logger.Error("Failed to get expired agent tasks: %v", err)
+		return
+	}
+
+	for _, task := range expired {
+		now := time.Now()
+		updates := map[string]interface{}{
+			"status":      TaskTimedOut,
+			"error":       "task timed out",
+			"deadline_at": nil,
+			"finished_at": now,
+		}
+		if task.Attempts <= task.MaxRetries {
+			updates["status"] = TaskPending
+			updates["finished_at"] = nil
+		}
+
+		// 按下发次数和状态条件更新，避免覆盖刚上报的结果
+		result := database.DB.Model(&models.AgentTask{}).
+			Where("id = ? AND attempts = ? AND status = ?", task.ID, task.Attempts, task.Status).
+			Updates(updates)
+		if result.Error != nil {
+			logger.Error("Failed to expire agent task %d: %v", task.ID, result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		logger.Warn("Agent task %d timed out after attempt %d", task.ID, task.Attempts)
+		if err := database.DB.First(&task, task.ID).Error; err == nil {
+			publishTaskUpdate(&task)
+		}
+	}
+}
+
+// publishTaskUpdate 向代理关联机器的订阅者推送任务状态
+func publishTaskUpdate(task *models.AgentTask) {
+	if utils.GlobalWebSocketManager == nil {
+		return
+	}
+	var agent models.Agent
+	if err := database.DB.Select("id", "machine_id").First(&agent, task.AgentID).Error; err != nil || agent.MachineID == nil {
+		return
+	}
+	utils.GlobalWebSocketManager.Publish(utils.MachineTopic(*agent.MachineID), utils.WebSocketMessage{
+		Type:    "agent_task_update",
+		Message: "Agent task updated",
+		Data:    task,
+	})
+}
@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"ft-backend/common/config"
 	"ft-backend/common/logger"
 	"ft-backend/database"
+	"ft-backend/iotservice"
 	"ft-backend/routes"
 	"ft-backend/utils"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
@@ -31,12 +36,48 @@ func main() {
 	logger.InitLogger(config.GlobalCfg.Log.Level, nil)
 	logger.Info("Loaded config: %+v", config.GlobalCfg)
 
-	// 初始化全局WebSocket管理器
-	utils.GlobalWebSocketManager = utils.NewWebSocketManager()
-	go utils.GlobalWebSocketManager.Start()
+	// 加载JWT签名密钥
+	keySet, err := utils.NewKeySet(cfg.JWT)
+	if err != nil {
+		logger.Error("Failed to load jwt keys: %v", err)
+		return
+	}
+	utils.GlobalKeySet = keySet
+
+	// 初始化邮件发送器
+	utils.GlobalMailer = utils.NewMailer(cfg.Mail)
+
+	// 初始化登录认证器链
+	utils.GlobalAuthenticator = utils.NewAuthenticatorChain(cfg.Auth)
+	if cfg.Auth.OIDC.Enabled {
+		utils.GlobalOIDCProvider = utils.NewOIDCProvider(cfg.Auth.OIDC)
+	}
+
+	// 权限缓存失效通知使用独立的频道，多实例部署时通过Redis通知其他实例
+	permissionBroker, err := utils.NewPermissionBroker(cfg.WebSocket, cfg.Redis)
+	if err != nil {
+		logger.Error("Failed to create permission broker: %v", err)
+		return
+	}
+	defer permissionBroker.Close()
+	if err := utils.GlobalPermissionCache.SubscribeInvalidations(permissionBroker); err != nil {
+		logger.Error("Failed to subscribe permission broker: %v", err)
+		return
+	}
 
-	// 启动机器状态监控器
-	go utils.StartMachineStatusMonitor()
+	// 初始化全局WebSocket管理器，多实例部署时通过Redis分发消息
+	broker, err := utils.NewWebSocketBroker(cfg.WebSocket, cfg.Redis)
+	if err != nil {
+		logger.Error("Failed to create websocket broker: %v", err)
+		return
+	}
+	wsManager, err := utils.NewWebSocketManager(cfg.WebSocket, broker)
+	if err != nil {
+		logger.Error("Failed to subscribe websocket broker: %v", err)
+		return
+	}
+	utils.GlobalWebSocketManager = wsManager
+	go utils.GlobalWebSocketManager.Start()
 
 	// 连接数据库
 	if err := database.Connect(&cfg.Database); err != nil {
@@ -51,6 +92,45 @@ func main() {
 		return
 	}
 
+	// 加载已吊销的令牌
+	revocations, err := utils.NewTokenRevocationList()
+	if err != nil {
+		logger.Error("Failed to load revoked tokens: %v", err)
+		return
+	}
+	utils.GlobalTokenRevocations = revocations
+
+	// 启动操作日志写入器，退出前写入剩余日志
+	utils.GlobalOperationLogger = utils.NewOperationLogger(cfg.OperationLog)
+	go utils.GlobalOperationLogger.Start()
+	defer utils.GlobalOperationLogger.Stop()
+
+	// 定期为操作日志哈希链创建签名检查点
+	checkpointInterval := cfg.OperationLog.CheckpointInterval
+	if checkpointInterval <= 0 {
+		checkpointInterval = 60
+	}
+	go utils.StartAuditCheckpointer(time.Duration(checkpointInterval) * time.Minute)
+
+	// 按保留策略归档并清理过期的操作日志
+	archiveDir := cfg.OperationLog.ArchiveDir
+	if archiveDir == "" {
+		archiveDir = "archives/operation_logs"
+	}
+	go utils.StartOperationLogRetention(cfg.OperationLog.RetentionDays, archiveDir)
+
+	// 启动机器状态监控器，按心跳推算机器在线状态
+	go utils.StartMachineStatusMonitor(cfg.Agent)
+
+	// 清理过期的客户端心跳历史和性能数据
+	go iotservice.StartHeartbeatRetention(cfg.Agent)
+
+	// 处理超时的代理任务
+	go iotservice.StartTaskTimeoutMonitor()
+
+	// 推送被订阅的传输记录和集群的变化
+	go utils.StartTopicWatcher()
+
 	// 创建上传目录
 	if err := os.MkdirAll(cfg.File.UploadDir, 0755); err != nil {
 		logger.Error("Failed to create upload directory: %v", err)
@@ -62,9 +142,29 @@ func main() {
 
 	// 启动服务器
 	serverAddr := fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port)
+	server := &http.Server{Addr: serverAddr, Handler: router}
 	logger.Info("Server starting on %s", serverAddr)
 
-	if err := http.ListenAndServe(serverAddr, router); err != nil {
-		logger.Error("Failed to start server: %v", err)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("Failed to start server: %v", err)
+			os.Exit(1)
+		}
+	}()
+
+	// 收到退出信号后优雅关闭：先关闭WebSocket和SSE连接，再停止接收新请求并等待进行中的请求，最后写入剩余的操作日志。
+	// SSE是普通HTTP请求，必须先让其退出，否则server.Shutdown会一直等到超时
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	logger.Info("Shutting down server")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := utils.GlobalWebSocketManager.Shutdown(ctx); err != nil {
+		logger.Error("Failed to close websocket connections: %v", err)
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error("Failed to shutdown server: %v", err)
 	}
 }
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"ft-backend/common/logger"
+	"ft-backend/database"
+	"ft-backend/models"
+	"ft-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyResources 路由前缀与API密钥权限资源的对应关系
+var apiKeyResources = map[string]string{
+	"dashboard":      "dashboard",
+	"user":           "users",
+	"users":          "users",
+	"machine":        "machines",
+	"agents":         "machines",
+	"agent-tasks":    "machines",
+	"agent-releases": "machines",
+	"agent-rollouts": "machines",
+	"notifications":  "notifications",
+	"files":          "files",
+	"transfers":      "files",
+	"security-audit": "audit",
+	"advanced":       "advanced",
+	"k8s":            "k8s",
+}
+
+// apiKeyResource 根据路由获取对应的权限资源，未登记的路由返回空字符串
+func apiKeyResource(path string) string {
+	path = strings.TrimPrefix(path, "/api/")
+	segment, _, _ := strings.Cut(path, "/")
+	return apiKeyResources[segment]
+}
+
+// authenticateAPIKey 使用API密钥认证请求
+func authenticateAPIKey(c *gin.Context, key string) {
+	var apiKey models.APIKey
+	if err := database.DB.Where("key_hash = ?", utils.HashToken(key)).First(&apiKey).Error; err != nil {
+		logger.Debug("Error: API key not found: %v", err)
+		abortUnauthorized(c, "Invalid API key")
+		return
+	}
+
+	now := time.Now()
+	if apiKey.RevokedAt != nil {
+		abortUnauthorized(c, "API key has been revoked")
+		return
+	}
+	if apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(now) {
+		abortUnauthorized(c, "API key has expired")
+		return
+	}
+
+	// 检查权限范围，未登记资源的路由（如API密钥管理）只能通过登录令牌访问
+	scopes := utils.ParseScopes(apiKey.Scopes)
+	resource := apiKeyResource(c.FullPath())
+	action := "write"
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		action = "read"
+	}
+	if resource == "" || !utils.ScopeAllows(scopes, resource, action) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code": 403,
+			"msg":  "API key scope does not allow this request",
+		})
+		c.Abort()
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, apiKey.UserID).Error; err != nil {
+		abortUnauthorized(c, "API key owner not found")
+		return
+	}
+
+	// 与登录令牌一致，被强制修改密码的用户在修改密码前不能通过API密钥访问
+	if user.MustChangePassword && !passwordChangeAllowedPaths[c.FullPath()] {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code": 403,
+			"msg":  "Password change required",
+		})
+		c.Abort()
+		return
+	}
+
+	// 异步记录最近使用时间和IP，避免拖慢请求
+	ip := c.ClientIP()
+	go func() {
+		if err := database.DB.Model(&models.APIKey{}).Where("id = ?", apiKey.ID).
+			Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": ip}).Error; err != nil {
+			logger.Error("更新API密钥使用记录失败: %v", err)
+		}
+	}()
+
+	logger.Debug("API key valid. KeyID: %d, UserID: %d", apiKey.ID, user.ID)
+	c.Set("userID", user.ID)
+	c.Set("username", user.Username)
+	c.Set("email", user.Email)
+	c.Set("role", user.Role)
+	c.Set("apiKeyID", apiKey.ID)
+	c.Next()
+}
+
+// abortUnauthorized 返回401并终止请求
+func abortUnauthorized(c *gin.Context, msg string) {
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"code": 401,
+		"msg":  msg,
+	})
+	c.Abort()
+}
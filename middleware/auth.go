@@ -11,11 +11,23 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// passwordChangeAllowedPaths 需要修改密码时仍允许访问的路由
+var passwordChangeAllowedPaths = map[string]bool{
+	"/api/auth/info":            true,
+	"/api/auth/password/change": true,
+}
+
 // JWTAuth JWT认证中间件
-func JWTAuth(secretKey string) gin.HandlerFunc {
+func JWTAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		logger.Debug("Processing request: %s %s", c.Request.Method, c.Request.URL.Path)
 
+		// 脚本和CI可以使用API密钥代替登录令牌
+		if apiKey := c.GetHeader(utils.APIKeyHeader); apiKey != "" {
+			authenticateAPIKey(c, apiKey)
+			return
+		}
+
 		// 从请求头获取token
 		authHeader := c.GetHeader("Authorization")
 		logger.Debug("Authorization header: %s", authHeader)
@@ -48,8 +60,7 @@ func JWTAuth(secretKey string) gin.HandlerFunc {
 		logger.Debug("Token string: %s", tokenString)
 
 		// 使用专门的验证函数来解析token
-		logger.Debug("Validating token with secret: %s", secretKey)
-		claims, err := utils.ValidateToken(tokenString, secretKey)
+		claims, err := utils.ValidateToken(tokenString)
 		if err != nil {
 			logger.Debug("Error validating token: %v", err)
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -60,6 +71,16 @@ func JWTAuth(secretKey string) gin.HandlerFunc {
 			return
 		}
 
+		// 被强制修改密码的用户只能访问修改密码相关接口
+		if claims.MustChangePassword && !passwordChangeAllowedPaths[c.FullPath()] {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code": 403,
+				"msg":  "Password change required",
+			})
+			c.Abort()
+			return
+		}
+
 		// 将用户信息存储到上下文，使用驼峰式命名
 		logger.Debug("Token valid. UserID: %d, Username: %s, Role: %s", claims.UserID, claims.Username, claims.Role)
 		c.Set("userID", claims.UserID)
@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"ft-backend/common/config"
+	"ft-backend/models"
+	"ft-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routeNamespaces 路由中的分组前缀，资源类型取其后的路径段
+var routeNamespaces = map[string]bool{
+	"security-audit": true,
+	"advanced":       true,
+	"k8s":            true,
+}
+
+// responseRecorder 记录响应体，用于提取失败原因
+type responseRecorder struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// OperationLog 操作日志中间件，记录所有修改类请求（POST/PUT/PATCH/DELETE），需放在JWTAuth之后
+func OperationLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		maxBodySize := 4096
+		if cfg, ok := c.Get("config"); ok && cfg.(*config.Config).OperationLog.MaxBodySize > 0 {
+			maxBodySize = cfg.(*config.Config).OperationLog.MaxBodySize
+		}
+
+		// 读取请求体后放回，供后续处理器使用；文件上传等非JSON请求不记录请求体
+		var requestBody string
+		if c.Request.Body != nil && strings.HasPrefix(c.ContentType(), "application/json") {
+			data, err := io.ReadAll(c.Request.Body)
+			if err == nil {
+				c.Request.Body = io.NopCloser(bytes.NewReader(data))
+				requestBody = redactRequestBody(data, maxBodySize)
+			}
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = recorder
+
+		c.Next()
+
+		resource, operation, resourceID := parseOperationRoute(c)
+		entry := &models.OperationLog{
+			Username:    c.GetString("username"),
+			Operation:   operation,
+			Resource:    resource,
+			ResourceID:  resourceID,
+			Method:      c.Request.Method,
+			Path:        truncateString(c.Request.URL.Path, 255),
+			RequestBody: requestBody,
+			IP:          c.ClientIP(),
+			UserAgent:   truncateString(c.Request.UserAgent(), 255),
+			Status:      "success",
+			CreatedAt:   time.Now(),
+		}
+		// 处理器通过recordChanges记录的字段级变更
+		if changes, ok := c.Get("operationChanges"); ok {
+			entry.Changes = changes.(models.FieldChanges)
+		}
+		if c.Writer.Status() >= http.StatusBadRequest {
+			entry.Status = "failed"
+			entry.ErrorMessage = truncateString(responseErrorMessage(c, recorder.body.Bytes()), 255)
+		}
+
+		if utils.GlobalOperationLogger != nil {
+			utils.GlobalOperationLogger.Log(entry)
+		}
+	}
+}
+
+// parseOperationRoute 根据路由模板解析资源类型、操作和资源ID，
+// 例如 PATCH /api/machine/:id/status 解析为 machine、status、:id 的值
+func parseOperationRoute(c *gin.Context) (resource, operation string, resourceID uint) {
+	switch c.Request.Method {
+	case http.MethodPost:
+		operation = "create"
+	case http.MethodPut, http.MethodPatch:
+		operation = "update"
+	case http.MethodDelete:
+		operation = "delete"
+	default:
+		operation = strings.ToLower(c.Request.Method)
+	}
+
+	route := c.FullPath()
+	if route == "" {
+		route = c.Request.URL.Path
+	}
+
+	var actions []string
+	for _, segment := range strings.Split(strings.TrimPrefix(route, "/api/"), "/") {
+		if segment == "" {
+			continue
+		}
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			if resourceID == 0 {
+				if id, err := strconv.ParseUint(c.Param(segment[1:]), 10, 32); err == nil {
+					resourceID = uint(id)
+				}
+			}
+			continue
+		}
+		if resource == "" {
+			if !routeNamespaces[segment] {
+				resource = segment
+			}
+			continue
+		}
+		actions = append(actions, segment)
+	}
+
+	if len(actions) > 0 {
+		action := strings.Join(actions, "_")
+		if action == "batch" {
+			action = "batch_" + operation
+		}
+		operation = action
+	}
+	return truncateString(resource, 100), truncateString(operation, 100), resourceID
+}
+
+// redactRequestBody 对请求体中的敏感字段脱敏，非JSON请求体不记录
+func redactRequestBody(data []byte, maxSize int) string {
+	if len(data) == 0 {
+		return ""
+	}
+
+	var body interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return ""
+	}
+
+	redacted, err := json.Marshal(redactValue(body))
+	if err != nil {
+		return ""
+	}
+	return truncateString(string(redacted), maxSize)
+}
+
+// redactValue 递归替换敏感字段的值
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if utils.IsSensitiveField(key) {
+				v[key] = utils.MaskedValue
+				continue
+			}
+			v[key] = redactValue(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// responseErrorMessage 提取失败原因，优先使用响应中的msg字段
+func responseErrorMessage(c *gin.Context, body []byte) string {
+	var response struct {
+		Msg string `json:"msg"`
+	}
+	if err := json.Unmarshal(body, &response); err == nil && response.Msg != "" {
+		return response.Msg
+	}
+	if len(c.Errors) > 0 {
+		return c.Errors.String()
+	}
+	return http.StatusText(c.Writer.Status())
+}
+
+// truncateString 按字节截断字符串，保证不截断多字节字符
+func truncateString(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	for maxLen > 0 && !utf8.RuneStart(s[maxLen]) {
+		maxLen--
+	}
+	return s[:maxLen]
+}
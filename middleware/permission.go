@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+
+	"ft-backend/common/logger"
+	"ft-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission 权限校验中间件，需在JWTAuth之后使用
+func RequirePermission(code string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+
+		allowed, err := utils.GlobalPermissionCache.HasPermission(role, code)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code": 500,
+				"msg":  "权限检查失败",
+			})
+			c.Abort()
+			return
+		}
+
+		if !allowed {
+			logger.Debug("Permission denied. Role: %s, Permission: %s", role, code)
+			c.JSON(http.StatusForbidden, gin.H{
+				"code": 403,
+				"msg":  "没有权限执行此操作",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireResourcePermission 资源级权限校验中间件，全局拥有权限或通过资源授权拥有部分资源权限时放行，
+// 计算出的范围保存在上下文的resourceScope中，由处理器按具体资源过滤
+func RequireResourcePermission(resourceType, code string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope, err := utils.ResolveResourceScope(c.GetString("username"), c.GetString("role"), resourceType, code)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code": 500,
+				"msg":  "权限检查失败",
+			})
+			c.Abort()
+			return
+		}
+
+		if scope.Empty() {
+			logger.Debug("Permission denied. User: %s, Resource: %s, Permission: %s", c.GetString("username"), resourceType, code)
+			c.JSON(http.StatusForbidden, gin.H{
+				"code": 403,
+				"msg":  "没有权限执行此操作",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set("resourceScope", scope)
+		c.Next()
+	}
+}
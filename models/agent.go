@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Agent 客户端代理，注册后获得ID和签名密钥，每次心跳时更新。
+// 心跳按IP/主机名匹配到的机器只作为SuggestedMachineID，管理员确认后才写入MachineID，机器状态和灰度都以MachineID为准
+type Agent struct {
+	ID                      uint       `gorm:"primaryKey" json:"id"`
+	ClientID                string     `gorm:"uniqueIndex;size:100;not null" json:"client_id"`
+	Version                 string     `gorm:"size:50;index" json:"version"`
+	PID                     int        `json:"pid"`
+	Status                  string     `gorm:"size:20;index" json:"status"`
+	LocalIP                 string     `gorm:"size:50" json:"local_ip"`
+	Hostname                string     `gorm:"size:100" json:"hostname"`
+	OSInfo                  string     `gorm:"size:200" json:"os_info"`
+	BusinessModule          string     `gorm:"size:100" json:"business_module"`
+	TaskCount               int        `json:"task_count"`
+	TaskLeft                int        `json:"task_left"`
+	LastTaskAt              *time.Time `json:"last_task_at,omitempty"`
+	MachineID               *uint      `gorm:"index" json:"machine_id,omitempty"`
+	SuggestedMachineID      *uint      `json:"suggested_machine_id,omitempty"` // 最近一次心跳自动匹配到的机器
+	MachineLinkedAt         *time.Time `json:"machine_linked_at,omitempty"`
+	MachineLinkedBy         string     `gorm:"size:50" json:"machine_linked_by,omitempty"`
+	FirstSeenAt             time.Time  `json:"first_seen_at"`
+	LastSeenAt              time.Time  `gorm:"index" json:"last_seen_at"`
+	EnrolledAt              *time.Time `json:"enrolled_at,omitempty"`
+	SecretRotatedAt         *time.Time `json:"secret_rotated_at,omitempty"`
+	RevokedAt               *time.Time `json:"revoked_at,omitempty"`
+	SecretCipher            string     `gorm:"size:255" json:"-"` // 加密保存的签名密钥
+	PreviousSecretCipher    string     `gorm:"size:255" json:"-"` // 轮换前的密钥，宽限期内仍可用于签名
+	PreviousSecretExpiresAt *time.Time `json:"-"`
+	CreatedAt               time.Time  `json:"created_at"`
+	UpdatedAt               time.Time  `json:"updated_at"`
+}
+
+// AgentHeartbeat 心跳历史样本，Hosts保存主机和副主机信息的JSON
+type AgentHeartbeat struct {
+	ID         uint            `gorm:"primaryKey" json:"id"`
+	AgentID    uint            `gorm:"index:idx_agent_heartbeat_agent_time;not null" json:"agent_id"`
+	ReceivedAt time.Time       `gorm:"index:idx_agent_heartbeat_agent_time;index" json:"received_at"`
+	ReportedAt time.Time       `json:"reported_at"` // 客户端上报的心跳时间
+	Version    string          `gorm:"size:50" json:"version"`
+	Status     string          `gorm:"size:20" json:"status"`
+	TaskCount  int             `json:"task_count"`
+	TaskLeft   int             `json:"task_left"`
+	Hosts      json.RawMessage `gorm:"type:text" json:"hosts"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import (
+	"time"
+)
+
+// AgentNonce 已使用的签名nonce，签名时间窗口内重复的nonce视为重放
+type AgentNonce struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	AgentID   uint      `gorm:"uniqueIndex:idx_agent_nonce;not null" json:"agent_id"` // 注册请求为0
+	Nonce     string    `gorm:"uniqueIndex:idx_agent_nonce;size:64;not null" json:"nonce"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// AgentRelease 客户端代理发布版本，安装包通过文件管理上传，Checksum为安装包的SHA-256
+type AgentRelease struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Version   string    `gorm:"uniqueIndex;size:50;not null" json:"version"`
+	FileID    uint      `gorm:"index;not null" json:"file_id"`
+	Checksum  string    `gorm:"size:64;not null" json:"checksum"`
+	Size      int64     `json:"size"`
+	Notes     string    `gorm:"type:text" json:"notes"`
+	CreatedBy string    `gorm:"size:50" json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AgentRolloutPolicy 机器分组的代理目标版本策略，按Percentage灰度下发升级指令，GroupName为空表示未分组的机器
+type AgentRolloutPolicy struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	GroupName  string    `gorm:"uniqueIndex;size:50" json:"group"`
+	Version    string    `gorm:"size:50;not null" json:"version"`
+	Percentage int       `gorm:"not null" json:"percentage"` // 0-100，按client_id和目标版本稳定分桶
+	Paused     bool      `json:"paused"`
+	UpdatedBy  string    `gorm:"size:50" json:"updated_by"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AgentTask 下发给客户端代理的任务，在心跳响应中下发，代理确认后通过结果接口上报执行状态和输出。
+// 超时或失败时在MaxRetries次数内重新排队，Attempts记录已下发的次数
+type AgentTask struct {
+	ID           uint            `gorm:"primaryKey" json:"id"`
+	AgentID      uint            `gorm:"index:idx_agent_task_agent_status;not null" json:"agent_id"`
+	Type         string          `gorm:"size:30;not null" json:"type"`
+	Payload      json.RawMessage `gorm:"type:text" json:"payload"`
+	Status       string          `gorm:"index:idx_agent_task_agent_status;size:20;not null" json:"status"`
+	Timeout      int             `json:"timeout"` // 单次执行的超时时间（秒），从下发时开始计算
+	MaxRetries   int             `json:"max_retries"`
+	Attempts     int             `json:"attempts"`
+	DispatchedAt *time.Time      `json:"dispatched_at,omitempty"`
+	AckedAt      *time.Time      `json:"acked_at,omitempty"`
+	DeadlineAt   *time.Time      `gorm:"index" json:"deadline_at,omitempty"`
+	FinishedAt   *time.Time      `json:"finished_at,omitempty"`
+	ExitCode     *int            `json:"exit_code,omitempty"`
+	Output       string          `gorm:"type:mediumtext" json:"output,omitempty"`
+	Error        string          `gorm:"type:text" json:"error,omitempty"`
+	CreatedBy    string          `gorm:"size:50" json:"created_by"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
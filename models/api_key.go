@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// APIKey 用户的个人API密钥，明文只在创建时返回一次，数据库中只保存哈希
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Prefix     string     `gorm:"size:20;not null" json:"prefix"` // 明文前缀，便于用户识别
+	KeyHash    string     `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	Scopes     string     `gorm:"size:500" json:"scopes"` // 逗号分隔，例如 files:read,machines:write，为空表示不限制
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `gorm:"size:50" json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// AuditCheckpoint 操作日志哈希链的签名检查点，记录某一时刻的链头，可导出用于外部归档
+type AuditCheckpoint struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	LogID     uint      `gorm:"index;not null" json:"logId"`      // 链头日志ID
+	LogHash   string    `gorm:"size:64;not null" json:"logHash"`  // 链头日志哈希
+	Payload   string    `gorm:"size:255;not null" json:"payload"` // 被签名的原文
+	Kid       string    `gorm:"size:50" json:"kid"`               // 签名密钥ID，对应JWKS中的公钥
+	Algorithm string    `gorm:"size:20;not null" json:"algorithm"`
+	Signature string    `gorm:"type:text;not null" json:"signature"` // base64url编码
+	CreatedAt time.Time `json:"createTime"`
+}
@@ -11,6 +11,7 @@ type K8sCluster struct {
 	MasterNode  string    `json:"master_node"`
 	WorkerNodes string    `json:"worker_nodes"`
 	Description string    `json:"description"`
+	GroupName   string    `gorm:"size:50;index" json:"group"` // 集群分组，用于按组授权
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
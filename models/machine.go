@@ -12,6 +12,8 @@ type Machine struct {
 	Memory    int       `gorm:"not null" json:"memory"`
 	Disk      int       `gorm:"not null" json:"disk"`
 	Status    string    `gorm:"size:20;default:'offline'" json:"status"`
+	GroupName string    `gorm:"size:50;index" json:"group"` // 机器分组，用于按组授权
+	StatusChangedAt *time.Time `json:"statusChangedAt,omitempty"` // 最近一次状态变更时间
 	CreatedAt time.Time `json:"createTime"`
 	UpdatedAt time.Time `json:"updateTime"`
 	DeletedAt *time.Time `gorm:"index" json:"deleted_at,omitempty"`
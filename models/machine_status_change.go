@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// MachineStatusChange 机器状态变更记录，Reason为heartbeat（由心跳推算）或manual（手动设置）
+type MachineStatusChange struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	MachineID  uint      `gorm:"index;not null" json:"machine_id"`
+	FromStatus string    `gorm:"size:20" json:"from_status"`
+	ToStatus   string    `gorm:"size:20;not null" json:"to_status"`
+	Reason     string    `gorm:"size:20" json:"reason"`
+	Operator   string    `gorm:"size:50" json:"operator,omitempty"`
+	ChangedAt  time.Time `gorm:"index" json:"changed_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Notification 用户通知，序号按用户递增，离线期间的通知在重新连接后按序号补发
+type Notification struct {
+	ID        uint            `gorm:"primaryKey" json:"id"`
+	UserID    uint            `gorm:"uniqueIndex:idx_notification_user_seq;not null" json:"user_id"`
+	Seq       uint64          `gorm:"uniqueIndex:idx_notification_user_seq;not null" json:"seq"`
+	Type      string          `gorm:"size:50;not null" json:"type"`
+	Message   string          `gorm:"size:500" json:"message"`
+	Data      json.RawMessage `gorm:"type:text" json:"data,omitempty"`
+	ReadAt    *time.Time      `gorm:"index" json:"read_at,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
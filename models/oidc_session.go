@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// OIDCSession 进行中的OIDC登录流程，按state的哈希记录nonce和PKCE校验码，回调时取出并删除。
+// 保存在数据库中，回调请求落到任意实例都能完成登录
+type OIDCSession struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	StateHash    string    `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	Nonce        string    `gorm:"size:64;not null" json:"-"`
+	CodeVerifier string    `gorm:"size:128;not null" json:"-"`
+	ExpiresAt    time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
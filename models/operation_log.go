@@ -1,18 +1,89 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"time"
 )
 
 type OperationLog struct {
-	ID            uint      `gorm:"primaryKey" json:"id"`
-	Username      string    `gorm:"size:50;not null" json:"username"`
-	Operation     string    `gorm:"size:100;not null" json:"operation"`
-	Resource      string    `gorm:"size:100;not null" json:"resource"`
-	ResourceID    uint      `json:"resourceId"`
-	IP            string    `gorm:"size:50;not null" json:"ip"`
-	UserAgent     string    `gorm:"size:255" json:"userAgent"`
-	Status        string    `gorm:"size:20;not null" json:"status"`
-	ErrorMessage  string    `gorm:"size:255" json:"errorMessage,omitempty"`
-	CreatedAt     time.Time `json:"createTime"`
+	ID           uint         `gorm:"primaryKey" json:"id"`
+	Username     string       `gorm:"size:50;not null" json:"username"`
+	Operation    string       `gorm:"size:100;not null" json:"operation"`
+	Resource     string       `gorm:"size:100;not null" json:"resource"`
+	ResourceID   uint         `json:"resourceId"`
+	Method       string       `gorm:"size:10" json:"method"`
+	Path         string       `gorm:"size:255" json:"path"`
+	RequestBody  string       `gorm:"type:text" json:"requestBody,omitempty"` // 敏感字段已脱敏
+	Changes      FieldChanges `gorm:"type:text" json:"changes,omitempty"`     // 更新操作的字段级变更
+	IP           string       `gorm:"size:50;not null" json:"ip"`
+	UserAgent    string       `gorm:"size:255" json:"userAgent"`
+	Status       string       `gorm:"size:20;not null" json:"status"`
+	ErrorMessage string       `gorm:"size:255" json:"errorMessage,omitempty"`
+	CreatedAt    time.Time    `json:"createTime"`
+	PrevHash     string       `gorm:"size:64" json:"prevHash"`
+	Hash         string       `gorm:"size:64;index" json:"hash"` // sha256(PrevHash + 日志内容)，修改、删除或插入日志都会使后续链接断开
+}
+
+// OperationLogChainHead 操作日志哈希链的链头，只有一行。多实例写入日志时在事务中锁定该行，保证各实例按同一链头依次追加
+type OperationLogChainHead struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	LogID     uint      `json:"logId"`
+	Hash      string    `gorm:"size:64" json:"hash"`
+	UpdatedAt time.Time `json:"updateTime"`
+}
+
+// OperationLogArchive 操作日志归档记录。归档按ID连续删除日志，最后一次归档的LastHash是剩余日志哈希链的锚点
+type OperationLogArchive struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	FirstLogID uint      `json:"firstLogId"`
+	LastLogID  uint      `json:"lastLogId"`
+	LastHash   string    `gorm:"size:64" json:"lastHash"` // 最后一条归档日志的哈希，归档的都是历史日志时为空
+	Count      int64     `json:"count"`
+	Path       string    `gorm:"size:500" json:"path"`
+	CreatedAt  time.Time `json:"createTime"`
+}
+
+// FieldChange 单个字段的变更，敏感字段的值已脱敏
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// FieldChanges 字段变更列表，以JSON文本存储
+type FieldChanges []FieldChange
+
+// Value 实现driver.Valuer
+func (changes FieldChanges) Value() (driver.Value, error) {
+	if len(changes) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan 实现sql.Scanner
+func (changes *FieldChanges) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*changes = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("invalid field changes value")
+	}
+	if len(data) == 0 {
+		*changes = nil
+		return nil
+	}
+	return json.Unmarshal(data, changes)
 }
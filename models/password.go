@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// PasswordHistory 用户历史密码，用于禁止重复使用近期密码
+type PasswordHistory struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index;not null" json:"user_id"`
+	Password  string    `gorm:"size:100;not null" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PasswordResetToken 找回密码的一次性令牌，只保存令牌哈希
+type PasswordResetToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	TokenHash string     `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -4,15 +4,22 @@ import (
 	"time"
 )
 
+// PerformanceData 机器性能数据，CPU、内存、磁盘为使用率百分比；
+// 心跳上报的数据在机器未填写内存/磁盘容量时无法换算百分比，对应的使用率为0，原始值保存在Bytes列中
 type PerformanceData struct {
-	ID           uint      `gorm:"primaryKey" json:"id"`
-	MachineID    uint      `gorm:"not null" json:"machineId"`
-	MachineName  string    `gorm:"size:100;not null" json:"machineName"`
-	CPUUsage     float64   `gorm:"not null" json:"cpuUsage"`
-	MemoryUsage  float64   `gorm:"not null" json:"memoryUsage"`
-	DiskUsage    float64   `gorm:"not null" json:"diskUsage"`
-	NetworkIn    float64   `json:"networkIn"`
-	NetworkOut   float64   `json:"networkOut"`
-	Timestamp    time.Time `json:"timestamp"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	MachineID     uint      `gorm:"not null;index:idx_performance_machine_time" json:"machineId"`
+	MachineName   string    `gorm:"size:100;not null" json:"machineName"`
+	CPUUsage      float64   `gorm:"not null" json:"cpuUsage"`
+	MemoryUsage   float64   `gorm:"not null" json:"memoryUsage"`
+	DiskUsage     float64   `gorm:"not null" json:"diskUsage"`
+	NetworkIn     float64   `json:"networkIn"`
+	NetworkOut    float64   `json:"networkOut"`
+	NetworkDelay  int       `json:"networkDelay"`  // 网络延迟（毫秒）
+	MemoryBytes   int64     `json:"memoryBytes"`   // 内存占用（字节）
+	DiskFreeBytes int64     `json:"diskFreeBytes"` // 磁盘可用空间（字节）
+	HostIP        string    `gorm:"size:50" json:"hostIp"`
+	Source        string    `gorm:"size:20" json:"source"` // 数据来源，heartbeat表示由客户端心跳生成
+	Timestamp     time.Time `gorm:"index:idx_performance_machine_time" json:"timestamp"`
+	CreatedAt     time.Time `json:"created_at"`
 }
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// ResourceGrant 资源级授权：在指定资源或资源分组范围内授予用户/角色某个角色的权限
+type ResourceGrant struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	SubjectType   string    `gorm:"size:20;not null;index:idx_grant_subject" json:"subjectType"` // user/role
+	Subject       string    `gorm:"size:50;not null;index:idx_grant_subject" json:"subject"`     // 用户名或角色名
+	ResourceType  string    `gorm:"size:20;not null" json:"resourceType"`                        // machine/cluster
+	ResourceID    uint      `json:"resourceId,omitempty"`                                        // 为0时按分组授权
+	ResourceGroup string    `gorm:"size:50" json:"resourceGroup,omitempty"`
+	Role          string    `gorm:"size:20;not null" json:"role"` // 在该范围内生效的角色
+	CreatedBy     string    `gorm:"size:50" json:"createdBy"`
+	CreatedAt     time.Time `json:"createTime"`
+}
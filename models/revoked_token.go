@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// RevokedToken 已吊销的访问令牌，按jti记录，令牌过期后可清理
+type RevokedToken struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TokenID   string    `gorm:"uniqueIndex;size:64;not null" json:"tokenId"`
+	Username  string    `gorm:"size:50" json:"username"`
+	ExpiresAt time.Time `gorm:"index" json:"expiresAt"`
+	CreatedAt time.Time `json:"createTime"`
+}
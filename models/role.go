@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// Role 角色，Name 与 User.Role、RolePermission.RoleID 对应
+type Role struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"uniqueIndex;size:20;not null" json:"name"`
+	DisplayName string    `gorm:"size:100" json:"displayName"`
+	Description string    `gorm:"size:255" json:"description,omitempty"`
+	Parent      string    `gorm:"size:20" json:"parent,omitempty"` // 继承的父角色，拥有父角色的全部权限
+	IsSystem    bool      `gorm:"default:false" json:"isSystem"`   // 系统内置角色不能删除
+	CreatedAt   time.Time `json:"createTime"`
+	UpdatedAt   time.Time `json:"updateTime"`
+}
@@ -5,19 +5,24 @@ import (
 )
 
 type User struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Username  string    `gorm:"uniqueIndex;size:50;not null" json:"username"`
-	Email     string    `gorm:"uniqueIndex;size:100;not null" json:"email"`
-	Phone     string    `gorm:"size:20" json:"phone"`
-	Password  string    `gorm:"size:100;not null" json:"-"`
-	FullName  string    `gorm:"size:100" json:"full_name"`
-	Avatar    string    `gorm:"size:255" json:"avatar"`
-	Role      string    `gorm:"size:20;default:'user'" json:"role"`
-	CreatedAt time.Time `json:"createTime"`
-	UpdatedAt time.Time `json:"updateTime"`
-	DeletedAt *time.Time `gorm:"index" json:"deleted_at,omitempty"`
+	ID                 uint       `gorm:"primaryKey" json:"id"`
+	Username           string     `gorm:"uniqueIndex;size:50;not null" json:"username"`
+	Email              string     `gorm:"uniqueIndex;size:100;not null" json:"email"`
+	Phone              string     `gorm:"size:20" json:"phone"`
+	Password           string     `gorm:"size:100;not null" json:"-"`
+	FullName           string     `gorm:"size:100" json:"full_name"`
+	Avatar             string     `gorm:"size:255" json:"avatar"`
+	Role               string     `gorm:"size:20;default:'user'" json:"role"`
+	AuthSource         string     `gorm:"size:20;default:'local'" json:"auth_source"`                               // local/ldap/oidc
+	ExternalIssuer     *string    `gorm:"size:191;uniqueIndex:idx_users_external" json:"external_issuer,omitempty"` // OIDC用户的iss，与sub一起唯一标识用户
+	ExternalSubject    *string    `gorm:"size:191;uniqueIndex:idx_users_external" json:"-"`                         // OIDC用户的sub，其他用户为NULL
+	MustChangePassword bool       `gorm:"default:false" json:"must_change_password"`
+	PasswordChangedAt  *time.Time `json:"password_changed_at,omitempty"`
+	CreatedAt          time.Time  `json:"createTime"`
+	UpdatedAt          time.Time  `json:"updateTime"`
+	DeletedAt          *time.Time `gorm:"index" json:"deleted_at,omitempty"`
 
 	// 关联
 	Files     []File     `gorm:"foreignKey:UserID" json:"files,omitempty"`
 	Transfers []Transfer `gorm:"foreignKey:UserID" json:"transfers,omitempty"`
-}
\ No newline at end of file
+}
@@ -2,9 +2,11 @@ package routes
 
 import (
 	"ft-backend/common/config"
+	"ft-backend/common/logger"
 	"ft-backend/handlers"
 	"ft-backend/iotservice"
 	"ft-backend/middleware"
+	"ft-backend/utils"
 
 	"github.com/gin-gonic/gin"
 ) // SetupRouter 设置路由
@@ -27,105 +29,187 @@ func SetupRouter(cfg *config.Config) *gin.Engine {
 	// 健康检查
 	r.GET("/health", handlers.HealthCheck)
 
+	// JWT验证公钥
+	r.GET("/.well-known/jwks.json", handlers.GetJWKS)
+
 	// 公开路由组 - API路径与前端保持一致
 	public := r.Group("/api")
 	{
 		// 用户认证
 		public.POST("/auth/login", handlers.Login)
 		public.POST("/auth/logout", handlers.Logout)
+		public.POST("/auth/password/forgot", handlers.ForgotPassword)
+		public.POST("/auth/password/reset", handlers.ResetPassword)
+
+		// OIDC单点登录
+		public.GET("/auth/oidc/login", handlers.OIDCLogin)
+		public.GET("/auth/oidc/callback", handlers.OIDCCallback)
 
 		// 文件下载（公开访问）
 		public.GET("/files/download/:file_id", handlers.DownloadFile)
 
-		// 调试接口 - 仅用于开发环境
-		public.GET("/debug/token", handlers.DebugGetToken)
-
-		// client接口相关
-		// // 客户端心跳
-		public.POST("/v1/heartbeats", iotservice.HeatbeatCheck)
+		// 调试接口 - 签发的令牌使用正式签名密钥，只在显式开启server.debug时注册
+		if cfg.Server.Debug {
+			logger.Warn("server.debug已开启，/api/debug/token可以无需认证签发管理员令牌，生产环境必须关闭")
+			public.GET("/debug/token", handlers.DebugGetToken)
+		}
+
+		// client接口相关，注册请求使用client.encrypt_key签名，其余请求使用代理密钥签名
+		public.POST("/v1/agents/enroll", iotservice.EnrollAgent)
+		public.POST("/v1/agents/rotate-secret", iotservice.AgentAuth(), iotservice.RotateAgentSecret)
+		// 客户端心跳
+		public.POST("/v1/heartbeats", iotservice.AgentAuth(), iotservice.HeatbeatCheck)
+		// 客户端上报任务状态和结果
+		public.POST("/v1/tasks/:id/result", iotservice.AgentAuth(), iotservice.ReportTaskResult)
+		// 客户端下载升级安装包
+		public.GET("/v1/agent-releases/:id/artifact", iotservice.AgentAuth(), iotservice.DownloadReleaseArtifact)
 	}
 
 	// 受保护路由组
 	protected := r.Group("/api")
-	protected.Use(middleware.JWTAuth(cfg.JWT.SecretKey))
+	protected.Use(middleware.JWTAuth(), middleware.OperationLog())
 	{
 		// 仪表盘数据
-		protected.GET("/dashboard/data", handlers.GetDashboardData)
+		protected.GET("/dashboard/data", middleware.RequirePermission("dashboard_view"), handlers.GetDashboardData)
 
-		// 用户管理
+		// 当前用户，所有已登录用户均可访问
 		protected.GET("/auth/info", handlers.GetUserProfile)
 		protected.PUT("/users/profile", handlers.UpdateUserProfile)
-		protected.GET("/user", handlers.GetUserList)
-		protected.GET("/user/:id", handlers.GetUserDetail)
-		protected.POST("/user", handlers.AddUser)
-		protected.PUT("/user/:id", handlers.UpdateUser)
-		protected.DELETE("/user/:id", handlers.DeleteUser)
-		protected.DELETE("/user/batch", handlers.BatchDeleteUser)
-		protected.PATCH("/user/:id/role", handlers.UpdateUserRole)
+		protected.POST("/auth/password/change", handlers.ChangePassword)
+
+		// 用户管理
+		protected.GET("/user", middleware.RequirePermission("user_view"), handlers.GetUserList)
+		protected.GET("/user/:id", middleware.RequirePermission("user_view"), handlers.GetUserDetail)
+		protected.POST("/user", middleware.RequirePermission("user_manage"), handlers.AddUser)
+		protected.PUT("/user/:id", middleware.RequirePermission("user_manage"), handlers.UpdateUser)
+		protected.DELETE("/user/:id", middleware.RequirePermission("user_manage"), handlers.DeleteUser)
+		protected.DELETE("/user/batch", middleware.RequirePermission("user_manage"), handlers.BatchDeleteUser)
+		protected.PATCH("/user/:id/role", middleware.RequirePermission("user_manage"), handlers.UpdateUserRole)
+		protected.POST("/user/:id/reset-password", middleware.RequirePermission("user_manage"), handlers.AdminResetPassword)
+		protected.GET("/user/:id/effective-permissions", middleware.RequirePermission("user_view"), handlers.GetUserEffectivePermissions)
+
+		// WebSocket在线用户
+		protected.GET("/websocket/presence", middleware.RequirePermission("user_view"), handlers.GetWebSocketPresence)
+
+		// API密钥，只能管理自己的密钥
+		protected.GET("/api-keys", handlers.GetAPIKeys)
+		protected.POST("/api-keys", handlers.CreateAPIKey)
+		protected.DELETE("/api-keys/:id", handlers.RevokeAPIKey)
+
+		// 通知，只能访问自己的通知
+		protected.GET("/notifications", handlers.GetNotifications)
+		protected.GET("/notifications/unread-count", handlers.GetUnreadNotificationCount)
+		protected.PUT("/notifications/:id/read", handlers.MarkNotificationRead)
+		protected.PUT("/notifications/read-all", handlers.MarkAllNotificationsRead)
 
 		// 机器管理
-		protected.GET("/machine", handlers.GetMachineList)
-		protected.GET("/machine/:id", handlers.GetMachineDetail)
-		protected.POST("/machine", handlers.AddMachine)
-		protected.PUT("/machine/:id", handlers.UpdateMachine)
-		protected.DELETE("/machine/:id", handlers.DeleteMachine)
-		protected.DELETE("/machine/batch", handlers.BatchDeleteMachine)
-		protected.PATCH("/machine/:id/status", handlers.UpdateMachineStatus)
+		protected.GET("/machine", middleware.RequireResourcePermission(utils.ResourceMachine, "machine_view"), handlers.GetMachineList)
+		protected.GET("/machine/:id", middleware.RequireResourcePermission(utils.ResourceMachine, "machine_view"), handlers.GetMachineDetail)
+		protected.GET("/machine/:id/status-history", middleware.RequireResourcePermission(utils.ResourceMachine, "machine_view"), handlers.GetMachineStatusHistory)
+		protected.POST("/machine", middleware.RequireResourcePermission(utils.ResourceMachine, "machine_manage"), handlers.AddMachine)
+		protected.PUT("/machine/:id", middleware.RequireResourcePermission(utils.ResourceMachine, "machine_manage"), handlers.UpdateMachine)
+		protected.DELETE("/machine/:id", middleware.RequireResourcePermission(utils.ResourceMachine, "machine_manage"), handlers.DeleteMachine)
+		protected.DELETE("/machine/batch", middleware.RequireResourcePermission(utils.ResourceMachine, "machine_manage"), handlers.BatchDeleteMachine)
+		protected.PATCH("/machine/:id/status", middleware.RequireResourcePermission(utils.ResourceMachine, "machine_manage"), handlers.UpdateMachineStatus)
+
+		// 客户端代理
+		protected.GET("/agents", middleware.RequireResourcePermission(utils.ResourceMachine, "machine_view"), handlers.GetAgents)
+		protected.GET("/agents/:id", middleware.RequireResourcePermission(utils.ResourceMachine, "machine_view"), handlers.GetAgentDetail)
+		protected.POST("/agents/:id/reset-secret", middleware.RequireResourcePermission(utils.ResourceMachine, "machine_manage"), handlers.ResetAgentSecret)
+		protected.POST("/agents/:id/revoke", middleware.RequireResourcePermission(utils.ResourceMachine, "machine_manage"), handlers.RevokeAgent)
+		protected.PUT("/agents/:id/machine", middleware.RequireResourcePermission(utils.ResourceMachine, "machine_manage"), handlers.LinkAgentMachine)
+		protected.DELETE("/agents/:id/machine", middleware.RequireResourcePermission(utils.ResourceMachine, "machine_manage"), handlers.UnlinkAgentMachine)
+		protected.GET("/agents/:id/tasks", middleware.RequireResourcePermission(utils.ResourceMachine, "machine_view"), handlers.GetAgentTasks)
+		protected.POST("/agents/:id/tasks", middleware.RequireResourcePermission(utils.ResourceMachine, "agent_task_manage"), handlers.CreateAgentTask)
+		protected.GET("/agent-tasks/:id", middleware.RequireResourcePermission(utils.ResourceMachine, "machine_view"), handlers.GetAgentTaskDetail)
+		protected.POST("/agent-tasks/:id/cancel", middleware.RequireResourcePermission(utils.ResourceMachine, "agent_task_manage"), handlers.CancelAgentTask)
+
+		// 代理版本发布和灰度
+		protected.GET("/agent-releases", middleware.RequirePermission("machine_view"), handlers.GetAgentReleases)
+		protected.POST("/agent-releases", middleware.RequirePermission("machine_manage"), handlers.CreateAgentRelease)
+		protected.DELETE("/agent-releases/:id", middleware.RequirePermission("machine_manage"), handlers.DeleteAgentRelease)
+		protected.GET("/agent-rollouts", middleware.RequirePermission("machine_view"), handlers.GetAgentRollouts)
+		protected.PUT("/agent-rollouts", middleware.RequirePermission("machine_manage"), handlers.SaveAgentRollout)
+		protected.DELETE("/agent-rollouts/:id", middleware.RequirePermission("machine_manage"), handlers.DeleteAgentRollout)
 
 		// 文件管理
-		protected.POST("/files/upload", handlers.UploadFile)
-		protected.GET("/files/list", handlers.ListFiles)
-		protected.GET("/files/:file_id", handlers.GetFileInfo)
-		protected.DELETE("/files/:file_id", handlers.DeleteFile)
+		protected.POST("/files/upload", middleware.RequirePermission("file_manage"), handlers.UploadFile)
+		protected.GET("/files/list", middleware.RequirePermission("file_view"), handlers.ListFiles)
+		protected.GET("/files/:file_id", middleware.RequirePermission("file_view"), handlers.GetFileInfo)
+		protected.DELETE("/files/:file_id", middleware.RequirePermission("file_manage"), handlers.DeleteFile)
 
 		// 文件分享
-		protected.POST("/files/share/:file_id", handlers.ShareFile)
-		protected.GET("/files/shared", handlers.GetSharedFiles)
+		protected.POST("/files/share/:file_id", middleware.RequirePermission("file_manage"), handlers.ShareFile)
+		protected.GET("/files/shared", middleware.RequirePermission("file_view"), handlers.GetSharedFiles)
 
 		// 传输记录
-		protected.GET("/transfers", handlers.GetTransferHistory)
+		protected.GET("/transfers", middleware.RequirePermission("transfer_view"), handlers.GetTransferHistory)
 
 		// 安全与审计
 		// 操作日志
-		protected.GET("/security-audit/operation-logs", handlers.GetOperationLogs)
-		protected.GET("/security-audit/operation-logs/:id", handlers.GetOperationLogDetail)
+		protected.GET("/security-audit/operation-logs", middleware.RequirePermission("security_audit"), handlers.GetOperationLogs)
+		protected.GET("/security-audit/operation-logs/:id", middleware.RequirePermission("security_audit"), handlers.GetOperationLogDetail)
+		protected.GET("/security-audit/operation-logs/verify", middleware.RequirePermission("security_audit"), handlers.VerifyOperationLogs)
+		protected.GET("/security-audit/operation-logs/export", middleware.RequirePermission("security_audit"), handlers.ExportOperationLogs)
+		protected.GET("/security-audit/operation-logs/stats", middleware.RequirePermission("security_audit"), handlers.GetOperationLogStats)
+
+		// 哈希链检查点
+		protected.GET("/security-audit/audit-checkpoints", middleware.RequirePermission("security_audit"), handlers.GetAuditCheckpoints)
+		protected.GET("/security-audit/audit-checkpoints/export", middleware.RequirePermission("security_audit"), handlers.ExportAuditCheckpoints)
 
 		// 权限管理
-		protected.GET("/security-audit/permissions", handlers.GetPermissions)
-		protected.GET("/security-audit/permissions/:id", handlers.GetPermissionDetail)
-		protected.POST("/security-audit/permissions", handlers.AddPermission)
-		protected.PUT("/security-audit/permissions/:id", handlers.UpdatePermission)
-		protected.DELETE("/security-audit/permissions/:id", handlers.DeletePermission)
-		protected.DELETE("/security-audit/permissions/batch", handlers.BatchDeletePermissions)
+		protected.GET("/security-audit/permissions", middleware.RequirePermission("permission_view"), handlers.GetPermissions)
+		protected.GET("/security-audit/permissions/:id", middleware.RequirePermission("permission_view"), handlers.GetPermissionDetail)
+		protected.POST("/security-audit/permissions", middleware.RequirePermission("permission_manage"), handlers.AddPermission)
+		protected.PUT("/security-audit/permissions/:id", middleware.RequirePermission("permission_manage"), handlers.UpdatePermission)
+		protected.DELETE("/security-audit/permissions/:id", middleware.RequirePermission("permission_manage"), handlers.DeletePermission)
+		protected.DELETE("/security-audit/permissions/batch", middleware.RequirePermission("permission_manage"), handlers.BatchDeletePermissions)
+
+		// 角色管理
+		protected.GET("/security-audit/roles", middleware.RequirePermission("permission_view"), handlers.GetRoles)
+		protected.GET("/security-audit/roles/:role", middleware.RequirePermission("permission_view"), handlers.GetRoleDetail)
+		protected.POST("/security-audit/roles", middleware.RequirePermission("permission_manage"), handlers.AddRole)
+		protected.PUT("/security-audit/roles/:role", middleware.RequirePermission("permission_manage"), handlers.UpdateRole)
+		protected.DELETE("/security-audit/roles/:role", middleware.RequirePermission("permission_manage"), handlers.DeleteRole)
 
 		// 角色权限
-		protected.GET("/security-audit/roles/:role/permissions", handlers.GetRolePermissions)
-		protected.POST("/security-audit/roles/:role/permissions", handlers.AssignRolePermissions)
+		protected.GET("/security-audit/roles/:role/permissions", middleware.RequirePermission("permission_view"), handlers.GetRolePermissions)
+		protected.POST("/security-audit/roles/:role/permissions", middleware.RequirePermission("permission_manage"), handlers.AssignRolePermissions)
+
+		// 资源授权
+		protected.GET("/security-audit/resource-grants", middleware.RequirePermission("permission_view"), handlers.GetResourceGrants)
+		protected.POST("/security-audit/resource-grants", middleware.RequirePermission("permission_manage"), handlers.AddResourceGrant)
+		protected.DELETE("/security-audit/resource-grants/:id", middleware.RequirePermission("permission_manage"), handlers.DeleteResourceGrant)
 
 		// 高级功能
 		// 备份与恢复
-		protected.GET("/advanced/backup", handlers.GetBackupList)
-		protected.GET("/advanced/backup/:id", handlers.GetBackupDetail)
-		protected.POST("/advanced/backup", handlers.Backup)
-		protected.POST("/advanced/restore/:id", handlers.Restore)
+		protected.GET("/advanced/backup", middleware.RequirePermission("backup_manage"), handlers.GetBackupList)
+		protected.GET("/advanced/backup/:id", middleware.RequirePermission("backup_manage"), handlers.GetBackupDetail)
+		protected.POST("/advanced/backup", middleware.RequirePermission("backup_manage"), handlers.Backup)
+		protected.POST("/advanced/restore/:id", middleware.RequirePermission("backup_manage"), handlers.Restore)
 
 		// 性能分析
-		protected.GET("/advanced/performance", handlers.GetPerformanceData)
-		protected.POST("/advanced/performance/report", handlers.GeneratePerformanceReport)
+		protected.GET("/advanced/performance", middleware.RequirePermission("performance_view"), handlers.GetPerformanceData)
+		protected.POST("/advanced/performance/report", middleware.RequirePermission("performance_view"), handlers.GeneratePerformanceReport)
 
 		// 调试接口 - 仅用于开发环境
-		protected.GET("/debug/test-auth", handlers.DebugTestAuth)
+		protected.GET("/debug/test-auth", middleware.RequirePermission("debug_access"), handlers.DebugTestAuth)
 
 		// K8s部署相关接口
-		protected.GET("/k8s/deploy/versions", handlers.GetK8sVersions)
-		protected.GET("/k8s/deploy/machines", handlers.GetK8sDeployMachines)
-		protected.GET("/k8s/deploy/check-name", handlers.CheckClusterName)
+		protected.GET("/k8s/deploy/versions", middleware.RequireResourcePermission(utils.ResourceCluster, "k8s_view"), handlers.GetK8sVersions)
+		protected.GET("/k8s/deploy/machines", middleware.RequireResourcePermission(utils.ResourceCluster, "k8s_view"), handlers.GetK8sDeployMachines)
+		protected.GET("/k8s/deploy/check-name", middleware.RequireResourcePermission(utils.ResourceCluster, "k8s_view"), handlers.CheckClusterName)
+		protected.GET("/k8s/clusters", middleware.RequireResourcePermission(utils.ResourceCluster, "k8s_view"), handlers.GetK8sClusters)
 
 	}
 
-	// WebSocket路由
+	// WebSocket路由，握手时通过token查询参数或Sec-WebSocket-Protocol验证身份
+	r.GET("/ws", handlers.WebSocketHandler)
 	r.GET("/ws/:user_id", handlers.WebSocketHandler)
 
+	// SSE事件流，供无法升级WebSocket的代理环境使用，身份验证方式同WebSocket
+	r.GET("/api/events", handlers.EventsHandler)
+
 	// 静态文件服务
 	r.Static("/uploads", cfg.File.UploadDir)
 
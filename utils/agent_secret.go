@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+)
+
+// ErrEncryptKeyMissing 未配置client.encrypt_key
+var ErrEncryptKeyMissing = errors.New("client.encrypt_key is not configured")
+
+// MinEnrollKeyLength 允许开放注册的client.encrypt_key最短长度，过短的密钥（如示例值）不能用于注册
+const MinEnrollKeyLength = 16
+
+// GenerateAgentSecret 生成代理签名密钥
+func GenerateAgentSecret() (string, error) {
+	return GenerateRandomToken(32)
+}
+
+// agentSecretCipher 由client.encrypt_key派生AES-256-GCM密钥
+func agentSecretCipher(encryptKey string) (cipher.AEAD, error) {
+	if encryptKey == "" {
+		return nil, ErrEncryptKeyMissing
+	}
+	key := sha256.Sum256([]byte(encryptKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptAgentSecret 加密代理密钥后保存，验证签名时需要还原明文，因此不能只保存哈希
+func EncryptAgentSecret(encryptKey, secret string) (string, error) {
+	aead, err := agentSecretCipher(encryptKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptAgentSecret 解密代理密钥
+func DecryptAgentSecret(encryptKey, encrypted string) (string, error) {
+	aead, err := agentSecretCipher(encryptKey)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < aead.NonceSize() {
+		return "", errors.New("invalid agent secret")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// AgentSignedRequest 代理请求中参与签名的内容
+type AgentSignedRequest struct {
+	Method    string
+	URI       string // 路径和查询参数，如 /api/v1/heartbeats
+	AgentID   string // X-Agent-ID，注册请求为空
+	Timestamp string
+	Nonce     string
+	Body      []byte
+}
+
+// SignAgentRequest 计算代理请求签名：
+// HMAC-SHA256(secret, method + "\n" + uri + "\n" + agentID + "\n" + timestamp + "\n" + nonce + "\n" + body)，十六进制编码。
+// 签名覆盖方法和路径，截获的请求不能改发到其他接口
+func SignAgentRequest(secret string, request AgentSignedRequest) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(request.Method + "\n" + request.URI + "\n" + request.AgentID + "\n" + request.Timestamp + "\n" + request.Nonce + "\n"))
+	mac.Write(request.Body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyAgentSignature 以常量时间比较代理请求签名
+func VerifyAgentSignature(secret string, request AgentSignedRequest, signature string) bool {
+	expected := SignAgentRequest(secret, request)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
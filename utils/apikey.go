@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// APIKeyHeader 携带API密钥的请求头
+	APIKeyHeader = "X-API-Key"
+	// apiKeyPrefix API密钥的固定前缀，便于在日志和代码仓库中识别泄露的密钥
+	apiKeyPrefix = "ftk_"
+)
+
+// APIKeyScopeResources API密钥可授权的资源
+var APIKeyScopeResources = []string{"dashboard", "users", "machines", "files", "audit", "advanced", "k8s", "notifications"}
+
+// GenerateAPIKey 生成新的API密钥，返回明文密钥和用于展示的前缀
+func GenerateAPIKey() (string, string, error) {
+	token, err := GenerateRandomToken(24)
+	if err != nil {
+		return "", "", err
+	}
+	key := apiKeyPrefix + token
+	return key, key[:len(apiKeyPrefix)+8], nil
+}
+
+// ParseScopes 解析逗号分隔的权限范围
+func ParseScopes(scopes string) []string {
+	var result []string
+	for _, scope := range strings.Split(scopes, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope != "" {
+			result = append(result, scope)
+		}
+	}
+	return result
+}
+
+// ValidateAPIKeyScopes 校验权限范围格式，格式为 资源:read 或 资源:write
+func ValidateAPIKeyScopes(scopes []string) error {
+	for _, scope := range scopes {
+		resource, action, ok := strings.Cut(scope, ":")
+		if !ok || (action != "read" && action != "write") {
+			return fmt.Errorf("invalid scope: %s", scope)
+		}
+		valid := false
+		for _, r := range APIKeyScopeResources {
+			if r == resource {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("unknown scope resource: %s", resource)
+		}
+	}
+	return nil
+}
+
+// ScopeAllows 判断权限范围是否允许对资源执行操作，write权限包含read
+func ScopeAllows(scopes []string, resource, action string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, scope := range scopes {
+		r, a, _ := strings.Cut(scope, ":")
+		if r != resource {
+			continue
+		}
+		if a == action || a == "write" {
+			return true
+		}
+	}
+	return false
+}
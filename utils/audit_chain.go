@@ -0,0 +1,306 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"ft-backend/common/logger"
+	"ft-backend/database"
+	"ft-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// operationLogHashContent 参与哈希计算的日志内容，字段顺序固定
+type operationLogHashContent struct {
+	PrevHash     string `json:"prevHash"`
+	Username     string `json:"username"`
+	Operation    string `json:"operation"`
+	Resource     string `json:"resource"`
+	ResourceID   uint   `json:"resourceId"`
+	Method       string `json:"method"`
+	Path         string `json:"path"`
+	RequestBody  string `json:"requestBody"`
+	Changes      string `json:"changes,omitempty"` // 启用变更记录前的日志没有该字段
+	IP           string `json:"ip"`
+	UserAgent    string `json:"userAgent"`
+	Status       string `json:"status"`
+	ErrorMessage string `json:"errorMessage"`
+	CreatedAt    int64  `json:"createdAt"` // 秒级时间戳，避免数据库时间精度影响
+}
+
+// ComputeOperationLogHash 计算日志的链式哈希
+func ComputeOperationLogHash(entry *models.OperationLog) string {
+	var changes string
+	if len(entry.Changes) > 0 {
+		data, _ := json.Marshal(entry.Changes)
+		changes = string(data)
+	}
+
+	data, _ := json.Marshal(operationLogHashContent{
+		PrevHash:     entry.PrevHash,
+		Username:     entry.Username,
+		Operation:    entry.Operation,
+		Resource:     entry.Resource,
+		ResourceID:   entry.ResourceID,
+		Method:       entry.Method,
+		Path:         entry.Path,
+		RequestBody:  entry.RequestBody,
+		Changes:      changes,
+		IP:           entry.IP,
+		UserAgent:    entry.UserAgent,
+		Status:       entry.Status,
+		ErrorMessage: entry.ErrorMessage,
+		CreatedAt:    entry.CreatedAt.Unix(),
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// operationLogChainHeadID 链头记录的固定ID
+const operationLogChainHeadID = 1
+
+// lockOperationLogChainHead 在事务中锁定并返回链头，链头记录不存在时按最后一条带哈希的日志创建
+func lockOperationLogChainHead(tx *gorm.DB) (*models.OperationLogChainHead, error) {
+	var head models.OperationLogChainHead
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&head, operationLogChainHeadID).Error
+	if err == nil {
+		return &head, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// 多个实例同时创建时只有一个成功，其余实例写入失败后重试
+	var last models.OperationLog
+	err = tx.Where("hash <> ''").Order("id DESC").First(&last).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	head = models.OperationLogChainHead{ID: operationLogChainHeadID, LogID: last.ID, Hash: last.Hash}
+	if err := tx.Create(&head).Error; err != nil {
+		return nil, err
+	}
+	return &head, nil
+}
+
+// ChainVerifyResult 哈希链校验结果
+type ChainVerifyResult struct {
+	Valid       bool   `json:"valid"`
+	Checked     int64  `json:"checked"`     // 校验的日志条数
+	Unhashed    int64  `json:"unhashed"`    // 启用哈希链之前的历史日志条数
+	FirstLogID  uint   `json:"firstLogId"`  // 链起点，更早的日志已归档时其PrevHash须与归档记录的锚点一致
+	HeadLogID   uint   `json:"headLogId"`   // 链头
+	HeadHash    string `json:"headHash"`    // 链头哈希
+	Checkpoints int    `json:"checkpoints"` // 通过校验的检查点数量
+	BrokenLogID uint   `json:"brokenLogId,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// fail 记录第一处断链
+func (r *ChainVerifyResult) fail(logID uint, reason string) {
+	if r.Valid {
+		r.Valid = false
+		r.BrokenLogID = logID
+		r.Reason = reason
+	}
+}
+
+// chainVerifier 按ID顺序逐条校验日志的哈希链
+type chainVerifier struct {
+	result      *ChainVerifyResult
+	archive     *models.OperationLogArchive // 最近一次归档记录，为空时以链起点的PrevHash为锚点
+	checkpoints map[uint][]models.AuditCheckpoint
+	started     bool
+	prevHash    string
+}
+
+// newChainVerifier 创建校验器，archive为最近一次归档记录，没有归档时为nil
+func newChainVerifier(archive *models.OperationLogArchive, checkpoints []models.AuditCheckpoint) *chainVerifier {
+	verifier := &chainVerifier{
+		result:      &ChainVerifyResult{Valid: true},
+		archive:     archive,
+		checkpoints: make(map[uint][]models.AuditCheckpoint),
+	}
+	for _, checkpoint := range checkpoints {
+		verifier.checkpoints[checkpoint.LogID] = append(verifier.checkpoints[checkpoint.LogID], checkpoint)
+	}
+	return verifier
+}
+
+// check 校验下一条日志，发现断链时返回false
+func (v *chainVerifier) check(entry *models.OperationLog) bool {
+	result := v.result
+	if !v.started && entry.Hash == "" {
+		result.Unhashed++
+		return true
+	}
+	if !v.started {
+		v.started = true
+		result.FirstLogID = entry.ID
+		v.prevHash = entry.PrevHash
+		if v.archive != nil {
+			v.prevHash = v.archive.LastHash
+		}
+	}
+	result.Checked++
+
+	switch {
+	case entry.Hash == "":
+		result.fail(entry.ID, "日志缺少哈希")
+	case entry.PrevHash != v.prevHash:
+		result.fail(entry.ID, "与上一条日志的哈希不匹配，日志可能被删除、插入或调整顺序")
+	case ComputeOperationLogHash(entry) != entry.Hash:
+		result.fail(entry.ID, "日志内容与哈希不匹配，日志可能被修改")
+	}
+	if !result.Valid {
+		return false
+	}
+
+	for _, checkpoint := range v.checkpoints[entry.ID] {
+		if checkpoint.LogHash != entry.Hash {
+			result.fail(entry.ID, fmt.Sprintf("与检查点%d记录的哈希不匹配", checkpoint.ID))
+			return false
+		}
+	}
+
+	v.prevHash = entry.Hash
+	result.HeadLogID = entry.ID
+	result.HeadHash = entry.Hash
+	return true
+}
+
+// VerifyOperationLogChain 按ID顺序遍历操作日志校验哈希链，并校验检查点签名及其记录的链头，报告第一处断链
+func VerifyOperationLogChain() (*ChainVerifyResult, error) {
+	var checkpoints []models.AuditCheckpoint
+	if err := database.DB.Order("id ASC").Find(&checkpoints).Error; err != nil {
+		return nil, err
+	}
+
+	// 最近一次归档记录的哈希是剩余日志的锚点，没有归档记录时以链起点的PrevHash为锚点
+	var archives []models.OperationLogArchive
+	if err := database.DB.Order("id DESC").Limit(1).Find(&archives).Error; err != nil {
+		return nil, err
+	}
+	var archive *models.OperationLogArchive
+	if len(archives) > 0 {
+		archive = &archives[0]
+	}
+
+	verifier := newChainVerifier(archive, checkpoints)
+	result := verifier.result
+
+	var batch []models.OperationLog
+	err := database.DB.Order("id ASC").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			if !verifier.check(&batch[i]) {
+				return errStopVerify
+			}
+		}
+		return nil
+	}).Error
+	if err != nil && !errors.Is(err, errStopVerify) {
+		return nil, err
+	}
+	if !result.Valid {
+		return result, nil
+	}
+
+	// 检查点签名及其记录的链头必须仍在链中，早于链起点的检查点对应已归档的日志
+	for _, checkpoint := range checkpoints {
+		if err := verifyCheckpointSignature(&checkpoint); err != nil {
+			result.fail(checkpoint.LogID, fmt.Sprintf("检查点%d签名无效: %v", checkpoint.ID, err))
+			return result, nil
+		}
+		if checkpoint.LogID > result.HeadLogID {
+			result.fail(checkpoint.LogID, fmt.Sprintf("检查点%d记录的日志已不存在，链尾日志可能被删除", checkpoint.ID))
+			return result, nil
+		}
+		if checkpoint.LogID >= result.FirstLogID {
+			result.Checkpoints++
+		}
+	}
+	return result, nil
+}
+
+// errStopVerify 发现断链后停止遍历
+var errStopVerify = errors.New("stop verify")
+
+// checkpointPayload 检查点的签名原文
+func checkpointPayload(logID uint, logHash string, createdAt time.Time) string {
+	return fmt.Sprintf("ft-audit-checkpoint|%d|%s|%d", logID, logHash, createdAt.Unix())
+}
+
+// verifyCheckpointSignature 校验检查点签名及签名原文
+func verifyCheckpointSignature(checkpoint *models.AuditCheckpoint) error {
+	if checkpoint.Payload != checkpointPayload(checkpoint.LogID, checkpoint.LogHash, checkpoint.CreatedAt) {
+		return errors.New("签名原文与检查点内容不一致")
+	}
+	return GlobalKeySet.VerifyDetached(checkpoint.Kid, []byte(checkpoint.Payload), checkpoint.Signature)
+}
+
+// CreateAuditCheckpoint 为当前链头创建签名检查点，链头没有变化时返回nil
+func CreateAuditCheckpoint() (*models.AuditCheckpoint, error) {
+	var head models.OperationLog
+	err := database.DB.Where("hash <> ''").Order("id DESC").First(&head).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var last models.AuditCheckpoint
+	err = database.DB.Order("id DESC").First(&last).Error
+	if err == nil && last.LogID == head.ID {
+		return nil, nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	createdAt := time.Now().Truncate(time.Second)
+	payload := checkpointPayload(head.ID, head.Hash, createdAt)
+	kid, alg, signature, err := GlobalKeySet.SignDetached([]byte(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint := &models.AuditCheckpoint{
+		LogID:     head.ID,
+		LogHash:   head.Hash,
+		Payload:   payload,
+		Kid:       kid,
+		Algorithm: alg,
+		Signature: signature,
+		CreatedAt: createdAt,
+	}
+	if err := database.DB.Create(checkpoint).Error; err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+// StartAuditCheckpointer 定期为操作日志哈希链创建签名检查点
+func StartAuditCheckpointer(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logger.Info("Audit checkpointer started, interval %v", interval)
+
+	for range ticker.C {
+		checkpoint, err := CreateAuditCheckpoint()
+		if err != nil {
+			logger.Error("创建审计检查点失败: %v", err)
+			continue
+		}
+		if checkpoint != nil {
+			logger.Debug("Created audit checkpoint %d at log %d", checkpoint.ID, checkpoint.LogID)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"ft-backend/models"
+)
+
+// buildOperationLogChain 生成ID从1开始的n条日志，前unhashed条为启用哈希链之前的历史日志
+func buildOperationLogChain(n, unhashed int) []models.OperationLog {
+	base := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	logs := make([]models.OperationLog, n)
+	prevHash := ""
+	for i := range logs {
+		entry := &logs[i]
+		entry.ID = uint(i + 1)
+		entry.Username = "admin"
+		entry.Operation = "更新机器"
+		entry.Resource = "machine"
+		entry.ResourceID = uint(i%3 + 1)
+		entry.Method = "PUT"
+		entry.Path = "/api/machine/1"
+		entry.IP = "10.0.0.1"
+		entry.Status = "success"
+		entry.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		if i%2 == 0 {
+			entry.Changes = models.FieldChanges{{Field: "status", Old: "offline", New: "online"}}
+		}
+		if i < unhashed {
+			continue
+		}
+		entry.PrevHash = prevHash
+		entry.Hash = ComputeOperationLogHash(entry)
+		prevHash = entry.Hash
+	}
+	return logs
+}
+
+func TestComputeOperationLogHash(t *testing.T) {
+	entry := buildOperationLogChain(1, 0)[0]
+	hash := ComputeOperationLogHash(&entry)
+	if len(hash) != 64 {
+		t.Fatalf("hash length = %d, want 64", len(hash))
+	}
+
+	// 数据库时间精度不同不影响哈希
+	withNanos := entry
+	withNanos.CreatedAt = entry.CreatedAt.Add(123 * time.Millisecond)
+	if got := ComputeOperationLogHash(&withNanos); got != hash {
+		t.Errorf("hash changed with sub-second precision: %s != %s", got, hash)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*models.OperationLog)
+	}{
+		{name: "prev hash", modify: func(e *models.OperationLog) { e.PrevHash = "00" }},
+		{name: "username", modify: func(e *models.OperationLog) { e.Username = "mallory" }},
+		{name: "request body", modify: func(e *models.OperationLog) { e.RequestBody = `{"name":"x"}` }},
+		{name: "changes", modify: func(e *models.OperationLog) { e.Changes[0].New = "offline" }},
+		{name: "changes removed", modify: func(e *models.OperationLog) { e.Changes = nil }},
+		{name: "status", modify: func(e *models.OperationLog) { e.Status = "failed" }},
+		{name: "created at", modify: func(e *models.OperationLog) { e.CreatedAt = e.CreatedAt.Add(time.Second) }},
+	}
+	for _, tt := range tests {
+		modified := entry
+		modified.Changes = append(models.FieldChanges(nil), entry.Changes...)
+		tt.modify(&modified)
+		if ComputeOperationLogHash(&modified) == hash {
+			t.Errorf("%s: hash unchanged after modification", tt.name)
+		}
+	}
+}
+
+func TestChainVerifierArchivedAnchor(t *testing.T) {
+	tests := []struct {
+		name      string
+		unhashed  int
+		archived  int  // 已归档删除的前几条日志
+		anchored  bool // 是否有归档记录
+		anchor    string
+		modify    func([]models.OperationLog) []models.OperationLog
+		wantValid bool
+		wantFirst uint
+		wantBroke uint
+		wantUnhas int64
+	}{
+		{name: "intact chain", wantValid: true, wantFirst: 1},
+		{name: "legacy unhashed prefix", unhashed: 3, wantValid: true, wantFirst: 4, wantUnhas: 3},
+		{name: "archived with matching anchor", archived: 4, anchored: true, wantValid: true, wantFirst: 5},
+		{name: "archived only legacy logs", unhashed: 3, archived: 3, anchored: true, wantValid: true, wantFirst: 4},
+		{
+			name: "first remaining log deleted after archive", archived: 4, anchored: true,
+			modify:    func(logs []models.OperationLog) []models.OperationLog { return logs[1:] },
+			wantFirst: 6, wantBroke: 6,
+		},
+		{
+			name: "anchor does not match", archived: 4, anchored: true, anchor: "0000",
+			wantFirst: 5, wantBroke: 5,
+		},
+		{
+			// 没有归档记录时无法发现开头的日志被删除
+			name: "leading logs deleted without archive record", archived: 4,
+			wantValid: true, wantFirst: 5,
+		},
+		{
+			name: "middle log deleted", archived: 2, anchored: true,
+			modify: func(logs []models.OperationLog) []models.OperationLog {
+				return append(logs[:3:3], logs[4:]...)
+			},
+			wantFirst: 3, wantBroke: 7,
+		},
+		{
+			name: "log modified", archived: 2, anchored: true,
+			modify: func(logs []models.OperationLog) []models.OperationLog {
+				logs[2].Username = "mallory"
+				return logs
+			},
+			wantFirst: 3, wantBroke: 5,
+		},
+	}
+	for _, tt := range tests {
+		all := buildOperationLogChain(10, tt.unhashed)
+		var archive *models.OperationLogArchive
+		if tt.anchored {
+			last := all[tt.archived-1]
+			archive = &models.OperationLogArchive{ID: 1, FirstLogID: 1, LastLogID: last.ID, LastHash: last.Hash}
+			if tt.anchor != "" {
+				archive.LastHash = tt.anchor
+			}
+		}
+		logs := all[tt.archived:]
+		if tt.modify != nil {
+			logs = tt.modify(logs)
+		}
+
+		verifier := newChainVerifier(archive, nil)
+		for i := range logs {
+			if !verifier.check(&logs[i]) {
+				break
+			}
+		}
+		result := verifier.result
+		if result.Valid != tt.wantValid {
+			t.Errorf("%s: valid = %v, want %v (reason %q)", tt.name, result.Valid, tt.wantValid, result.Reason)
+		}
+		if result.FirstLogID != tt.wantFirst {
+			t.Errorf("%s: first log = %d, want %d", tt.name, result.FirstLogID, tt.wantFirst)
+		}
+		if result.BrokenLogID != tt.wantBroke {
+			t.Errorf("%s: broken log = %d, want %d", tt.name, result.BrokenLogID, tt.wantBroke)
+		}
+		if result.Unhashed != tt.wantUnhas {
+			t.Errorf("%s: unhashed = %d, want %d", tt.name, result.Unhashed, tt.wantUnhas)
+		}
+		if tt.wantValid && result.HeadLogID != 10 {
+			t.Errorf("%s: head log = %d, want 10", tt.name, result.HeadLogID)
+		}
+	}
+}
+
+func TestChainVerifierCheckpointMismatch(t *testing.T) {
+	logs := buildOperationLogChain(5, 0)
+	checkpoints := []models.AuditCheckpoint{
+		{ID: 1, LogID: 2, LogHash: logs[1].Hash},
+		{ID: 2, LogID: 4, LogHash: "0000"},
+	}
+
+	verifier := newChainVerifier(nil, checkpoints)
+	for i := range logs {
+		if !verifier.check(&logs[i]) {
+			break
+		}
+	}
+	if verifier.result.Valid || verifier.result.BrokenLogID != 4 {
+		t.Errorf("result = %+v, want broken at log 4", verifier.result)
+	}
+}
@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"ft-backend/common/logger"
+	"ft-backend/database"
+	"ft-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// ArchiveOperationLogs 将早于before的操作日志写入gzip压缩的NDJSON文件，写入成功后再从数据库删除。
+// 归档按ID连续进行：取早于before的最大日志ID作为截止点，归档并删除截止点及之前的全部日志，
+// 保证剩余日志仍是一段完整的哈希链；链头日志始终保留，以便检查点在归档后仍可校验。
+// 最后一条归档日志的哈希记录为剩余日志的锚点，归档文件保留完整的哈希字段，可与剩余日志接续校验
+func ArchiveOperationLogs(before time.Time, archiveDir string) (int64, string, error) {
+	var head models.OperationLog
+	if err := database.DB.Order("id DESC").Limit(1).Find(&head).Error; err != nil {
+		return 0, "", err
+	}
+	if head.ID == 0 {
+		return 0, "", nil
+	}
+
+	var cutoff sql.NullInt64
+	err := database.DB.Model(&models.OperationLog{}).Select("MAX(id)").
+		Where("created_at < ? AND id < ?", before, head.ID).Scan(&cutoff).Error
+	if err != nil {
+		return 0, "", err
+	}
+	if !cutoff.Valid {
+		return 0, "", nil
+	}
+
+	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+		return 0, "", err
+	}
+	path := filepath.Join(archiveDir, fmt.Sprintf("operation-logs-%s.ndjson.gz", time.Now().Format("20060102150405")))
+
+	archive, err := writeOperationLogArchive(path, uint(cutoff.Int64))
+	if err != nil {
+		os.Remove(path)
+		return 0, "", err
+	}
+	if archive.Count == 0 {
+		os.Remove(path)
+		return 0, "", nil
+	}
+	archive.Path = path
+
+	// 只删除已写入归档文件的日志，并在同一事务中记录新的锚点
+	var deleted int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id <= ?", archive.LastLogID).Delete(&models.OperationLog{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		return tx.Create(archive).Error
+	})
+	if err != nil {
+		return 0, path, err
+	}
+	return deleted, path, nil
+}
+
+// writeOperationLogArchive 按ID顺序写入截止点及之前的日志并同步到磁盘，返回归档的ID范围、条数和最后一条日志的哈希
+func writeOperationLogArchive(path string, cutoff uint) (*models.OperationLogArchive, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	encoder := json.NewEncoder(gz)
+
+	rows, err := database.DB.Model(&models.OperationLog{}).
+		Where("id <= ?", cutoff).Order("id ASC").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	archive := &models.OperationLogArchive{}
+	for rows.Next() {
+		var entry models.OperationLog
+		if err := database.DB.ScanRows(rows, &entry); err != nil {
+			return nil, err
+		}
+		if err := encoder.Encode(entry); err != nil {
+			return nil, err
+		}
+		if archive.Count == 0 {
+			archive.FirstLogID = entry.ID
+		}
+		archive.LastLogID = entry.ID
+		archive.LastHash = entry.Hash
+		archive.Count++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	if err := file.Sync(); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// StartOperationLogRetention 每天按保留天数归档并清理过期的操作日志，retentionDays为0时不清理
+func StartOperationLogRetention(retentionDays int, archiveDir string) {
+	if retentionDays <= 0 {
+		logger.Info("Operation log retention disabled")
+		return
+	}
+
+	logger.Info("Operation log retention started, keep %d days, archive to %s", retentionDays, archiveDir)
+
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		before := time.Now().AddDate(0, 0, -retentionDays)
+		deleted, path, err := ArchiveOperationLogs(before, archiveDir)
+		if err != nil {
+			logger.Error("归档操作日志失败: %v", err)
+		} else if deleted > 0 {
+			logger.Info("Archived %d operation logs to %s", deleted, path)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,242 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"ft-backend/common/config"
+	"ft-backend/common/logger"
+	"ft-backend/database"
+	"ft-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// GlobalAuthenticator 全局登录认证器
+var GlobalAuthenticator Authenticator
+
+var (
+	// ErrInvalidCredentials 用户名或密码错误
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrUserNotFound 当前认证器中不存在该用户，认证器链会继续尝试下一个
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// Authenticator 登录认证器接口
+type Authenticator interface {
+	Name() string
+	Authenticate(username, password string) (*models.User, error)
+}
+
+// AuthenticatorChain 按顺序尝试多个认证器，第一个成功的结果生效
+type AuthenticatorChain struct {
+	authenticators []Authenticator
+}
+
+// LocalAuthenticator 使用users表中的密码哈希认证
+type LocalAuthenticator struct{}
+
+// NewAuthenticatorChain 根据配置创建认证器链
+func NewAuthenticatorChain(cfg config.AuthConfig) *AuthenticatorChain {
+	providers := cfg.Providers
+	if len(providers) == 0 {
+		providers = []string{"local"}
+	}
+
+	chain := &AuthenticatorChain{}
+	for _, name := range providers {
+		switch name {
+		case "local":
+			chain.authenticators = append(chain.authenticators, &LocalAuthenticator{})
+		case "ldap":
+			chain.authenticators = append(chain.authenticators, NewLDAPAuthenticator(cfg.LDAP))
+		default:
+			logger.Warn("Unknown auth provider: %s", name)
+		}
+	}
+	return chain
+}
+
+// Name 认证器名称
+func (chain *AuthenticatorChain) Name() string {
+	return "chain"
+}
+
+// Authenticate 依次尝试各认证器，某个认证器出错时记录日志并继续尝试下一个
+func (chain *AuthenticatorChain) Authenticate(username, password string) (*models.User, error) {
+	for _, authenticator := range chain.authenticators {
+		user, err := authenticator.Authenticate(username, password)
+		if err == nil {
+			logger.Debug("User %s authenticated by %s", username, authenticator.Name())
+			return user, nil
+		}
+		if !errors.Is(err, ErrUserNotFound) && !errors.Is(err, ErrInvalidCredentials) {
+			logger.Error("Authenticator %s failed: %v", authenticator.Name(), err)
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// Name 认证器名称
+func (a *LocalAuthenticator) Name() string {
+	return "local"
+}
+
+// Authenticate 校验本地用户密码，外部目录同步的用户不允许使用本地密码登录
+func (a *LocalAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	var user models.User
+	if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if user.AuthSource != "" && user.AuthSource != "local" {
+		return nil, ErrUserNotFound
+	}
+
+	if !CheckPasswordHash(password, user.Password) {
+		return nil, ErrInvalidCredentials
+	}
+	return &user, nil
+}
+
+// MapGroupsToRole 按配置顺序把外部目录的组映射为角色
+func MapGroupsToRole(groups []string, mappings []config.GroupRoleMapping, defaultRole string) string {
+	for _, mapping := range mappings {
+		for _, group := range groups {
+			if strings.EqualFold(group, mapping.Group) {
+				return mapping.Role
+			}
+		}
+	}
+	if defaultRole != "" {
+		return defaultRole
+	}
+	return "user"
+}
+
+// ProvisionExternalUser 创建或更新外部目录（LDAP）用户对应的本地用户，按用户名匹配
+func ProvisionExternalUser(source, username, email, fullName, role string) (*models.User, error) {
+	email = externalEmail(source, username, email)
+	role = existingRole(source, username, role)
+
+	var user models.User
+	err := database.DB.Where("username = ?", username).First(&user).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	if err == gorm.ErrRecordNotFound {
+		return createExternalUser(models.User{
+			Username:   username,
+			Email:      email,
+			FullName:   fullName,
+			Role:       role,
+			AuthSource: source,
+		})
+	}
+
+	// 同名的其他来源用户不能被接管
+	if user.AuthSource != source {
+		logger.Warn("%s user %s conflicts with existing %s user", source, username, user.AuthSource)
+		return nil, ErrInvalidCredentials
+	}
+
+	user.Email = email
+	user.FullName = fullName
+	user.Role = role
+	if err := database.DB.Save(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to update %s user: %w", source, err)
+	}
+	return &user, nil
+}
+
+// ProvisionOIDCUser 创建或更新OIDC用户对应的本地用户。按签发方和sub匹配，
+// 身份提供方的用户名可能被修改或回收给其他人，只在创建本地用户时作为用户名
+func ProvisionOIDCUser(identity *OIDCIdentity, role string) (*models.User, error) {
+	email := externalEmail("oidc", identity.Username, identity.Email)
+	role = existingRole("oidc", identity.Username, role)
+
+	var user models.User
+	err := database.DB.Where("external_issuer = ? AND external_subject = ?", identity.Issuer, identity.Subject).First(&user).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	if err == gorm.ErrRecordNotFound {
+		var existing models.User
+		err = database.DB.Where("username = ?", identity.Username).First(&existing).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return nil, err
+		}
+		if err == gorm.ErrRecordNotFound {
+			return createExternalUser(models.User{
+				Username:        identity.Username,
+				Email:           email,
+				FullName:        identity.FullName,
+				Role:            role,
+				AuthSource:      "oidc",
+				ExternalIssuer:  &identity.Issuer,
+				ExternalSubject: &identity.Subject,
+			})
+		}
+
+		// 记录sub之前创建的OIDC用户在下一次登录时绑定；已绑定其他sub的同名用户和其他来源的用户不能被接管
+		if existing.AuthSource != "oidc" || existing.ExternalSubject != nil {
+			logger.Warn("oidc user %s (sub %s) conflicts with existing %s user", identity.Username, identity.Subject, existing.AuthSource)
+			return nil, ErrInvalidCredentials
+		}
+		logger.Info("Linking oidc user %s to subject %s", existing.Username, identity.Subject)
+		user = existing
+		user.ExternalIssuer = &identity.Issuer
+		user.ExternalSubject = &identity.Subject
+	}
+
+	user.Email = email
+	user.FullName = identity.FullName
+	user.Role = role
+	if err := database.DB.Save(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to update oidc user: %w", err)
+	}
+	return &user, nil
+}
+
+// externalEmail 邮箱在本地是唯一且必填的，身份源没有提供邮箱时生成占位地址
+func externalEmail(source, username, email string) string {
+	if email == "" {
+		return fmt.Sprintf("%s@%s.local", username, source)
+	}
+	return email
+}
+
+// existingRole 映射到不存在的角色时退回默认角色
+func existingRole(source, username, role string) string {
+	var roleCount int64
+	database.DB.Model(&models.Role{}).Where("name = ?", role).Count(&roleCount)
+	if roleCount == 0 {
+		logger.Warn("Role %s mapped for %s user %s does not exist, using user", role, source, username)
+		return "user"
+	}
+	return role
+}
+
+// createExternalUser 创建外部身份源用户，本地密码随机生成且不会告知任何人，外部用户只能通过身份源登录
+func createExternalUser(user models.User) (*models.User, error) {
+	randomPassword, err := GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := HashPassword(randomPassword)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = hashedPassword
+	if err := database.DB.Create(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to provision %s user: %w", user.AuthSource, err)
+	}
+	logger.Info("Provisioned %s user %s with role %s", user.AuthSource, user.Username, user.Role)
+	return &user, nil
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"ft-backend/models"
+)
+
+// MaskedValue 脱敏后的字段值
+const MaskedValue = "******"
+
+// sensitiveFieldKeywords 字段名包含这些关键字时视为敏感字段
+var sensitiveFieldKeywords = []string{"password", "token", "secret", "apikey", "api_key", "keyhash", "encrypt_key", "signature"}
+
+// diffIgnoredFields 不记录变更的字段
+var diffIgnoredFields = map[string]bool{
+	"ID":        true,
+	"CreatedAt": true,
+	"UpdatedAt": true,
+	"DeletedAt": true,
+}
+
+// IsSensitiveField 判断字段名是否为敏感字段
+func IsSensitiveField(name string) bool {
+	lower := strings.ToLower(name)
+	for _, keyword := range sensitiveFieldKeywords {
+		if strings.Contains(lower, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// DiffModels 比较同一模型更新前后的字段，返回字段级变更，字段名使用json标签，
+// 敏感字段（如不输出到json的密码）只记录发生了变更，值已脱敏
+func DiffModels(before, after interface{}) models.FieldChanges {
+	oldValue := reflect.Indirect(reflect.ValueOf(before))
+	newValue := reflect.Indirect(reflect.ValueOf(after))
+	if oldValue.Kind() != reflect.Struct || oldValue.Type() != newValue.Type() {
+		return nil
+	}
+
+	var changes models.FieldChanges
+	modelType := oldValue.Type()
+	for i := 0; i < modelType.NumField(); i++ {
+		field := modelType.Field(i)
+		if !field.IsExported() || diffIgnoredFields[field.Name] || isRelationField(field.Type) {
+			continue
+		}
+
+		oldField := diffValue(oldValue.Field(i))
+		newField := diffValue(newValue.Field(i))
+		if reflect.DeepEqual(oldField, newField) {
+			continue
+		}
+
+		name := diffFieldName(field)
+		if IsSensitiveField(name) {
+			oldField, newField = MaskedValue, MaskedValue
+		}
+		changes = append(changes, models.FieldChange{Field: name, Old: oldField, New: newField})
+	}
+	return changes
+}
+
+// diffFieldName 字段名优先使用json标签，json:"-"的字段使用首字母小写的Go字段名
+func diffFieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return strings.ToLower(field.Name[:1]) + field.Name[1:]
+	}
+	return name
+}
+
+// isRelationField 关联字段（切片、结构体）不参与比较，time.Time除外
+func isRelationField(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return false
+	}
+	return t.Kind() == reflect.Slice || t.Kind() == reflect.Struct || t.Kind() == reflect.Map
+}
+
+// diffValue 取出用于比较和记录的值，指针解引用，时间格式化为字符串
+func diffValue(value reflect.Value) interface{} {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if t, ok := value.Interface().(time.Time); ok {
+		return t.Format("2006-01-02 15:04:05")
+	}
+	return value.Interface()
+}
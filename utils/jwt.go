@@ -2,6 +2,7 @@ package utils
 
 import (
 	"errors"
+	"strconv"
 	"time"
 
 	"ft-backend/common/logger"
@@ -9,56 +10,64 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// ErrTokenRevoked 令牌已被吊销
+var ErrTokenRevoked = errors.New("token has been revoked")
+
 // JWTClaims JWT claims结构
 type JWTClaims struct {
 	UserID   uint   `json:"user_id"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
 	Role     string `json:"role"`
+	// MustChangePassword 为true时只允许访问修改密码等少量接口
+	MustChangePassword bool `json:"must_change_password,omitempty"`
 	jwt.RegisteredClaims
 }
 
 // GenerateAccessToken 生成访问令牌
-func GenerateAccessToken(userID uint, username, email, role, secretKey string, expiresIn int) (string, error) {
-	claims := JWTClaims{
+func GenerateAccessToken(userID uint, username, email, role string, expiresIn int) (string, error) {
+	return SignAccessToken(JWTClaims{
 		UserID:   userID,
 		Username: username,
 		Email:    email,
 		Role:     role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expiresIn) * time.Minute)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Subject:   username,
-		},
+	}, expiresIn)
+}
+
+// SignAccessToken 使用给定的声明生成访问令牌，自动填充过期时间等注册声明，jti用于吊销
+func SignAccessToken(claims JWTClaims, expiresIn int) (string, error) {
+	tokenID, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expiresIn) * time.Minute)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		Subject:   claims.Username,
+		ID:        tokenID,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secretKey))
+	return GlobalKeySet.Sign(claims)
 }
 
 // GenerateRefreshToken 生成刷新令牌
-func GenerateRefreshToken(userID uint, username, secretKey string, expiresIn int) (string, error) {
+func GenerateRefreshToken(userID uint, username string, expiresIn int) (string, error) {
 	claims := jwt.RegisteredClaims{
 		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expiresIn) * time.Minute)),
 		IssuedAt:  jwt.NewNumericDate(time.Now()),
 		Subject:   username,
-		ID:        string(rune(userID)),
+		ID:        strconv.FormatUint(uint64(userID), 10),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secretKey))
+	return GlobalKeySet.Sign(claims)
 }
 
 // ValidateToken 验证令牌
-func ValidateToken(tokenString, secretKey string) (*JWTClaims, error) {
+func ValidateToken(tokenString string) (*JWTClaims, error) {
 	logger.Debug("正在验证JWT令牌")
-	logger.Debug("使用的密钥: %s", secretKey)
-
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		logger.Debug("令牌签名方法: %v", token.Method)
-		return []byte(secretKey), nil
-	})
 
+	token, err := GlobalKeySet.Parse(tokenString, &JWTClaims{})
 	if err != nil {
 		logger.Error("令牌解析错误: %v", err)
 		return nil, err
@@ -68,6 +77,11 @@ func ValidateToken(tokenString, secretKey string) (*JWTClaims, error) {
 
 	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
 		logger.Debug("JWT声明信息: %+v", claims)
+		if GlobalTokenRevocations != nil {
+			if err := GlobalTokenRevocations.Check(claims); err != nil {
+				return nil, err
+			}
+		}
 		return claims, nil
 	}
 
@@ -76,11 +90,11 @@ func ValidateToken(tokenString, secretKey string) (*JWTClaims, error) {
 }
 
 // ExtractUserIDFromToken 从令牌中提取用户ID
-func ExtractUserIDFromToken(tokenString, secretKey string) (uint, error) {
-	claims, err := ValidateToken(tokenString, secretKey)
+func ExtractUserIDFromToken(tokenString string) (uint, error) {
+	claims, err := ValidateToken(tokenString)
 	if err != nil {
 		return 0, err
 	}
 
 	return claims.UserID, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,349 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"ft-backend/common/config"
+	"ft-backend/common/logger"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// GlobalKeySet 全局JWT签名密钥集
+var GlobalKeySet *KeySet
+
+// minHMACSecretLength HS256密钥的最小建议长度
+const minHMACSecretLength = 32
+
+// signingKey 密钥集中的单个密钥，只有公钥的密钥仅用于验证已签发的令牌
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// KeySet JWT签名密钥集，支持多个密钥按kid区分，便于轮换
+type KeySet struct {
+	method    jwt.SigningMethod
+	hmac      []byte
+	activeKid string
+	keys      map[string]*signingKey
+}
+
+// NewKeySet 根据配置加载密钥集，私钥文件不存在时自动生成
+func NewKeySet(cfg config.JWTConfig) (*KeySet, error) {
+	alg := cfg.Algorithm
+	if alg == "" {
+		alg = jwt.SigningMethodHS256.Alg()
+	}
+
+	var method jwt.SigningMethod
+	switch alg {
+	case "HS256":
+		method = jwt.SigningMethodHS256
+	case "RS256":
+		method = jwt.SigningMethodRS256
+	case "ES256":
+		method = jwt.SigningMethodES256
+	case "EdDSA":
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported jwt algorithm: %s", alg)
+	}
+
+	ks := &KeySet{method: method, keys: make(map[string]*signingKey)}
+
+	if method == jwt.SigningMethodHS256 {
+		if len(cfg.SecretKey) < minHMACSecretLength {
+			logger.Warn("JWT secret_key is shorter than %d characters, consider switching to an asymmetric algorithm", minHMACSecretLength)
+		}
+		ks.hmac = []byte(cfg.SecretKey)
+		return ks, nil
+	}
+
+	for _, keyCfg := range cfg.Keys {
+		if keyCfg.Kid == "" {
+			return nil, errors.New("jwt key kid is required")
+		}
+		if _, exists := ks.keys[keyCfg.Kid]; exists {
+			return nil, fmt.Errorf("duplicate jwt key kid: %s", keyCfg.Kid)
+		}
+
+		key, err := loadSigningKey(keyCfg, method, keyCfg.Kid == cfg.ActiveKid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load jwt key %s: %w", keyCfg.Kid, err)
+		}
+		ks.keys[keyCfg.Kid] = key
+	}
+
+	active, ok := ks.keys[cfg.ActiveKid]
+	if !ok {
+		return nil, fmt.Errorf("active jwt key %q is not configured", cfg.ActiveKid)
+	}
+	if active.private == nil {
+		return nil, fmt.Errorf("active jwt key %q has no private key", cfg.ActiveKid)
+	}
+	if active.method != method {
+		return nil, fmt.Errorf("active jwt key %q uses %s, expected %s", cfg.ActiveKid, active.method.Alg(), alg)
+	}
+	ks.activeKid = cfg.ActiveKid
+
+	logger.Info("Loaded %d jwt keys, signing with %s kid=%s", len(ks.keys), alg, ks.activeKid)
+	return ks, nil
+}
+
+// Sign 使用当前活动密钥签名
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if ks.hmac != nil {
+		return jwt.NewWithClaims(ks.method, claims).SignedString(ks.hmac)
+	}
+
+	key := ks.keys[ks.activeKid]
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
+
+// Parse 验证令牌签名并解析声明，令牌的算法必须与kid对应密钥的算法一致
+func (ks *KeySet) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	if ks.hmac != nil {
+		return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+			return ks.hmac, nil
+		}, jwt.WithValidMethods([]string{ks.method.Alg()}))
+	}
+
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown jwt kid: %q", kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("jwt algorithm %s does not match key %s", token.Method.Alg(), kid)
+		}
+		return key.public, nil
+	}, jwt.WithValidMethods(ks.algorithms()))
+}
+
+// SignDetached 使用当前活动密钥对任意数据签名，返回kid、算法和base64url编码的签名，
+// 非对称算法的签名可以用JWKS中的公钥独立验证
+func (ks *KeySet) SignDetached(payload []byte) (kid, alg, signature string, err error) {
+	var sig []byte
+	if ks.hmac != nil {
+		sig, err = ks.method.Sign(string(payload), ks.hmac)
+	} else {
+		key := ks.keys[ks.activeKid]
+		kid = key.kid
+		sig, err = key.method.Sign(string(payload), key.private)
+	}
+	if err != nil {
+		return "", "", "", err
+	}
+	return kid, ks.method.Alg(), base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// VerifyDetached 验证SignDetached生成的签名
+func (ks *KeySet) VerifyDetached(kid string, payload []byte, signature string) error {
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+	if ks.hmac != nil {
+		return ks.method.Verify(string(payload), sig, ks.hmac)
+	}
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return fmt.Errorf("unknown jwt kid: %q", kid)
+	}
+	return key.method.Verify(string(payload), sig, key.public)
+}
+
+// JWKS 返回所有公钥，包括已停用但仍用于验证旧令牌的密钥
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	kids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	for _, kid := range kids {
+		key := ks.keys[kid]
+		jwk, err := publicJWK(key.kid, key.method.Alg(), key.public)
+		if err != nil {
+			logger.Warn("Skip jwk %s: %v", kid, err)
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// algorithms 密钥集中允许的算法
+func (ks *KeySet) algorithms() []string {
+	seen := make(map[string]bool)
+	var algs []string
+	for _, key := range ks.keys {
+		if alg := key.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+// loadSigningKey 加载单个密钥，活动密钥的私钥文件不存在时生成新密钥
+func loadSigningKey(cfg config.JWTKeyConfig, method jwt.SigningMethod, active bool) (*signingKey, error) {
+	if cfg.PrivateKeyFile != "" {
+		data, err := os.ReadFile(cfg.PrivateKeyFile)
+		if os.IsNotExist(err) && active {
+			data, err = generatePrivateKeyFile(cfg.PrivateKeyFile, method)
+		}
+		if err != nil {
+			return nil, err
+		}
+		private, err := parsePrivateKeyPEM(data)
+		if err != nil {
+			return nil, err
+		}
+		keyMethod, err := methodForKey(private.Public())
+		if err != nil {
+			return nil, err
+		}
+		return &signingKey{kid: cfg.Kid, method: keyMethod, private: private, public: private.Public()}, nil
+	}
+
+	if cfg.PublicKeyFile == "" {
+		return nil, errors.New("private_key_file or public_key_file is required")
+	}
+	data, err := os.ReadFile(cfg.PublicKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid public key pem")
+	}
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	keyMethod, err := methodForKey(public)
+	if err != nil {
+		return nil, err
+	}
+	return &signingKey{kid: cfg.Kid, method: keyMethod, public: public}, nil
+}
+
+// methodForKey 根据公钥类型确定签名算法
+func methodForKey(public crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 ecdsa keys are supported")
+		}
+		return jwt.SigningMethodES256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", public)
+	}
+}
+
+// parsePrivateKeyPEM 解析PKCS#8、PKCS#1或SEC1格式的私钥
+func parsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid private key pem")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("unsupported private key format")
+}
+
+// generatePrivateKeyFile 生成新私钥并以PKCS#8格式写入文件
+func generatePrivateKeyFile(path string, method jwt.SigningMethod) ([]byte, error) {
+	var private crypto.Signer
+	var err error
+	switch method {
+	case jwt.SigningMethodRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jwt.SigningMethodES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwt.SigningMethodEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("cannot generate key for %s", method.Alg())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, err
+	}
+	logger.Info("Generated new %s jwt key: %s", method.Alg(), path)
+	return data, nil
+}
+
+// publicJWK 将公钥转换为JWK
+func publicJWK(kid, alg string, public crypto.PublicKey) (JWK, error) {
+	jwk := JWK{Kid: kid, Use: "sig", Alg: alg}
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = k.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(k.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(k.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(k)
+	default:
+		return JWK{}, fmt.Errorf("unsupported key type %T", public)
+	}
+	return jwk, nil
+}
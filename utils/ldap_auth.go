@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"ft-backend/common/config"
+	"ft-backend/models"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPAuthenticator 通过LDAP绑定认证用户，并在首次登录时自动创建本地用户
+type LDAPAuthenticator struct {
+	cfg config.LDAPConfig
+}
+
+// ldapEntry 从目录中查到的用户信息
+type ldapEntry struct {
+	DN       string
+	Email    string
+	FullName string
+	Groups   []string
+}
+
+// NewLDAPAuthenticator 创建LDAP认证器
+func NewLDAPAuthenticator(cfg config.LDAPConfig) *LDAPAuthenticator {
+	return &LDAPAuthenticator{cfg: cfg}
+}
+
+// Name 认证器名称
+func (a *LDAPAuthenticator) Name() string {
+	return "ldap"
+}
+
+// Authenticate 查找用户DN并以用户身份绑定，成功后同步本地用户和角色
+func (a *LDAPAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	entry, err := a.lookup(username, password)
+	if err != nil {
+		return nil, err
+	}
+	return a.provisionUser(username, entry)
+}
+
+// lookup 在目录中验证用户名密码，返回用户条目和所属组
+func (a *LDAPAuthenticator) lookup(username, password string) (*ldapEntry, error) {
+	// 空密码会被很多LDAP服务器当作匿名绑定而返回成功
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := a.bindService(conn); err != nil {
+		return nil, err
+	}
+
+	entry, err := a.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap user bind failed: %w", err)
+	}
+
+	// 以服务账号身份查询组，用户自身可能没有查询权限
+	if err := a.bindService(conn); err != nil {
+		return nil, err
+	}
+	groups, err := a.findGroups(conn, entry.DN)
+	if err != nil {
+		return nil, err
+	}
+	entry.Groups = append(entry.Groups, groups...)
+	return entry, nil
+}
+
+// dial 连接LDAP服务器
+func (a *LDAPAuthenticator) dial() (*ldap.Conn, error) {
+	timeout := time.Duration(a.cfg.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: a.cfg.InsecureSkipVerify}
+
+	conn, err := ldap.DialURL(a.cfg.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect ldap server: %w", err)
+	}
+	conn.SetTimeout(timeout)
+
+	if a.cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap start tls failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// bindService 以服务账号绑定，未配置服务账号时使用匿名绑定
+func (a *LDAPAuthenticator) bindService(conn *ldap.Conn) error {
+	var err error
+	if a.cfg.BindDN == "" {
+		err = conn.UnauthenticatedBind("")
+	} else {
+		err = conn.Bind(a.cfg.BindDN, a.cfg.BindPassword)
+	}
+	if err != nil {
+		return fmt.Errorf("ldap service bind failed: %w", err)
+	}
+	return nil
+}
+
+// findUser 按用户过滤条件查找唯一的用户条目
+func (a *LDAPAuthenticator) findUser(conn *ldap.Conn, username string) (*ldapEntry, error) {
+	filter := a.cfg.UserFilter
+	if filter == "" {
+		filter = "(uid=%s)"
+	}
+
+	attrs := []string{"dn", "memberOf"}
+	if a.cfg.EmailAttr != "" {
+		attrs = append(attrs, a.cfg.EmailAttr)
+	}
+	if a.cfg.FullNameAttr != "" {
+		attrs = append(attrs, a.cfg.FullNameAttr)
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(filter, ldap.EscapeFilter(username)),
+		attrs,
+		nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("ldap user search failed: %w", err)
+	}
+	if len(result.Entries) == 0 {
+		return nil, ErrUserNotFound
+	}
+	if len(result.Entries) > 1 {
+		return nil, fmt.Errorf("ldap user search returned %d entries for %s", len(result.Entries), username)
+	}
+
+	e := result.Entries[0]
+	entry := &ldapEntry{DN: e.DN}
+	if a.cfg.EmailAttr != "" {
+		entry.Email = e.GetAttributeValue(a.cfg.EmailAttr)
+	}
+	if a.cfg.FullNameAttr != "" {
+		entry.FullName = e.GetAttributeValue(a.cfg.FullNameAttr)
+	}
+	// Active Directory 直接在用户条目上提供 memberOf
+	for _, dn := range e.GetAttributeValues("memberOf") {
+		entry.Groups = append(entry.Groups, groupNameFromDN(dn))
+	}
+	return entry, nil
+}
+
+// findGroups 查询用户所属的组名
+func (a *LDAPAuthenticator) findGroups(conn *ldap.Conn, userDN string) ([]string, error) {
+	if a.cfg.GroupBaseDN == "" || a.cfg.GroupFilter == "" {
+		return nil, nil
+	}
+
+	nameAttr := a.cfg.GroupNameAttr
+	if nameAttr == "" {
+		nameAttr = "cn"
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.GroupBaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf(a.cfg.GroupFilter, ldap.EscapeFilter(userDN)),
+		[]string{nameAttr},
+		nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("ldap group search failed: %w", err)
+	}
+
+	groups := make([]string, 0, len(result.Entries))
+	for _, e := range result.Entries {
+		groups = append(groups, e.GetAttributeValue(nameAttr))
+	}
+	return groups, nil
+}
+
+// groupNameFromDN 从组DN中取出第一个RDN的值，例如 cn=admins,ou=groups → admins
+func groupNameFromDN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 {
+		return dn
+	}
+	return parsed.RDNs[0].Attributes[0].Value
+}
+
+// provisionUser 创建或更新LDAP用户对应的本地用户
+func (a *LDAPAuthenticator) provisionUser(username string, entry *ldapEntry) (*models.User, error) {
+	role := MapGroupsToRole(entry.Groups, a.cfg.GroupRoles, a.cfg.DefaultRole)
+	return ProvisionExternalUser("ldap", username, entry.Email, entry.FullName, role)
+}
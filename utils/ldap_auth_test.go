@@ -0,0 +1,358 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+
+	"ft-backend/common/config"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	testServiceDN       = "cn=svc,dc=example,dc=com"
+	testServicePassword = "svc-pass"
+	testAliceDN         = "uid=alice,ou=people,dc=example,dc=com"
+	testBobDN           = "uid=bob,ou=people,dc=example,dc=com"
+)
+
+// ldapTestEntry 本地LDAP测试服务返回的目录条目
+type ldapTestEntry struct {
+	dn    string
+	attrs map[string][]string
+}
+
+// ldapStandIn 只实现绑定和搜索的本地LDAP服务，搜索结果按过滤条件字符串预置
+type ldapStandIn struct {
+	listener       net.Listener
+	passwords      map[string]string          // DN → 密码
+	results        map[string][]ldapTestEntry // 过滤条件 → 条目
+	allowAnonymous bool                       // 是否允许匿名绑定后搜索
+
+	mutex    sync.Mutex
+	binds    []string // 成功绑定的DN，匿名绑定记为空字符串
+	searches []string // 收到的过滤条件
+}
+
+func newLDAPStandIn(t *testing.T, allowAnonymous bool) *ldapStandIn {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := &ldapStandIn{
+		listener:       listener,
+		allowAnonymous: allowAnonymous,
+		passwords: map[string]string{
+			testServiceDN: testServicePassword,
+			testAliceDN:   "alice-pass",
+			testBobDN:     "bob-pass",
+		},
+		results: map[string][]ldapTestEntry{
+			"(uid=alice)": {{
+				dn: testAliceDN,
+				attrs: map[string][]string{
+					"mail":     {"alice@example.com"},
+					"cn":       {"Alice Liu"},
+					"memberOf": {"cn=ops,ou=groups,dc=example,dc=com"},
+				},
+			}},
+			"(uid=bob)": {{dn: testBobDN, attrs: map[string][]string{"cn": {"Bob"}}}},
+			"(uid=twin)": {
+				{dn: "uid=twin,ou=people,dc=example,dc=com"},
+				{dn: "uid=twin,ou=contractors,dc=example,dc=com"},
+			},
+			"(member=" + ldap.EscapeFilter(testAliceDN) + ")": {
+				{dn: "cn=developers,ou=groups,dc=example,dc=com", attrs: map[string][]string{"cn": {"developers"}}},
+			},
+		},
+	}
+	t.Cleanup(func() { listener.Close() })
+	go server.serve()
+	return server
+}
+
+func (s *ldapStandIn) url() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *ldapStandIn) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *ldapStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+
+	boundDN := ""
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			name := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			expected, ok := s.passwords[name]
+			if (name == "" && password == "") || (ok && password == expected) {
+				boundDN = name
+				s.record(&s.binds, name)
+				s.writeResult(conn, messageID, ldap.ApplicationBindResponse, ldap.LDAPResultSuccess)
+			} else {
+				s.writeResult(conn, messageID, ldap.ApplicationBindResponse, ldap.LDAPResultInvalidCredentials)
+			}
+		case ldap.ApplicationSearchRequest:
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				s.writeResult(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError)
+				continue
+			}
+			s.record(&s.searches, filter)
+			// 目录只允许服务账号（或允许时的匿名连接）搜索
+			if boundDN != testServiceDN && !(boundDN == "" && s.allowAnonymous) {
+				s.writeResult(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights)
+				continue
+			}
+			for _, entry := range s.results[filter] {
+				s.writeEntry(conn, messageID, entry)
+			}
+			s.writeResult(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess)
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func (s *ldapStandIn) record(list *[]string, value string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	*list = append(*list, value)
+}
+
+func (s *ldapStandIn) recorded(list *[]string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), *list...)
+}
+
+func (s *ldapStandIn) writeResult(conn net.Conn, messageID int64, tag ber.Tag, code uint16) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	s.writeMessage(conn, messageID, op)
+}
+
+func (s *ldapStandIn) writeEntry(conn net.Conn, messageID int64, entry ldapTestEntry) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "Object Name"))
+	attributes := ber.NewSequence("Attributes")
+	for name, values := range entry.attrs {
+		attribute := ber.NewSequence("Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	op.AppendChild(attributes)
+	s.writeMessage(conn, messageID, op)
+}
+
+func (s *ldapStandIn) writeMessage(conn net.Conn, messageID int64, op *ber.Packet) {
+	envelope := ber.NewSequence("LDAP Response")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	envelope.AppendChild(op)
+	conn.Write(envelope.Bytes())
+}
+
+func newTestLDAPAuthenticator(server *ldapStandIn) *LDAPAuthenticator {
+	return NewLDAPAuthenticator(config.LDAPConfig{
+		URL:           server.url(),
+		Timeout:       5,
+		BindDN:        testServiceDN,
+		BindPassword:  testServicePassword,
+		BaseDN:        "ou=people,dc=example,dc=com",
+		UserFilter:    "(uid=%s)",
+		EmailAttr:     "mail",
+		FullNameAttr:  "cn",
+		GroupBaseDN:   "ou=groups,dc=example,dc=com",
+		GroupFilter:   "(member=%s)",
+		GroupNameAttr: "cn",
+		GroupRoles: []config.GroupRoleMapping{
+			{Group: "Developers", Role: "operator"},
+			{Group: "ops", Role: "admin"},
+		},
+		DefaultRole: "user",
+	})
+}
+
+func TestLDAPLookup(t *testing.T) {
+	server := newLDAPStandIn(t, false)
+	authenticator := newTestLDAPAuthenticator(server)
+
+	entry, err := authenticator.lookup("alice", "alice-pass")
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if entry.DN != testAliceDN || entry.Email != "alice@example.com" || entry.FullName != "Alice Liu" {
+		t.Errorf("entry = %+v", entry)
+	}
+	// memberOf 中的组在前，组搜索查到的组在后
+	if want := []string{"ops", "developers"}; !reflect.DeepEqual(entry.Groups, want) {
+		t.Errorf("groups = %v, want %v", entry.Groups, want)
+	}
+
+	// 以服务账号查找用户，以用户身份验证密码，再切回服务账号查询组
+	if want := []string{testServiceDN, testAliceDN, testServiceDN}; !reflect.DeepEqual(server.recorded(&server.binds), want) {
+		t.Errorf("binds = %v, want %v", server.recorded(&server.binds), want)
+	}
+
+	// 按配置顺序匹配，组名不区分大小写
+	role := MapGroupsToRole(entry.Groups, authenticator.cfg.GroupRoles, authenticator.cfg.DefaultRole)
+	if role != "operator" {
+		t.Errorf("role = %q, want operator", role)
+	}
+}
+
+func TestLDAPLookupWithoutGroups(t *testing.T) {
+	server := newLDAPStandIn(t, false)
+	authenticator := newTestLDAPAuthenticator(server)
+
+	entry, err := authenticator.lookup("bob", "bob-pass")
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if len(entry.Groups) != 0 {
+		t.Errorf("groups = %v, want none", entry.Groups)
+	}
+	if entry.Email != "" {
+		t.Errorf("email = %q, want empty", entry.Email)
+	}
+	if role := MapGroupsToRole(entry.Groups, authenticator.cfg.GroupRoles, authenticator.cfg.DefaultRole); role != "user" {
+		t.Errorf("role = %q, want default role user", role)
+	}
+}
+
+func TestLDAPLookupInvalidCredentials(t *testing.T) {
+	server := newLDAPStandIn(t, false)
+	authenticator := newTestLDAPAuthenticator(server)
+
+	if _, err := authenticator.lookup("alice", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password: err = %v, want ErrInvalidCredentials", err)
+	}
+
+	// 空密码不能作为匿名绑定通过验证，也不会连接服务器
+	binds := len(server.recorded(&server.binds))
+	if _, err := authenticator.lookup("alice", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("empty password: err = %v, want ErrInvalidCredentials", err)
+	}
+	if len(server.recorded(&server.binds)) != binds {
+		t.Error("empty password reached the ldap server")
+	}
+}
+
+func TestLDAPLookupUserNotFound(t *testing.T) {
+	server := newLDAPStandIn(t, false)
+	authenticator := newTestLDAPAuthenticator(server)
+
+	if _, err := authenticator.lookup("carol", "carol-pass"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("err = %v, want ErrUserNotFound", err)
+	}
+
+	// 用户名中的过滤条件元字符必须被转义
+	if _, err := authenticator.lookup("*", "alice-pass"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("wildcard username: err = %v, want ErrUserNotFound", err)
+	}
+	searches := server.recorded(&server.searches)
+	if want := fmt.Sprintf("(uid=%s)", ldap.EscapeFilter("*")); searches[len(searches)-1] != want {
+		t.Errorf("filter = %q, want %q", searches[len(searches)-1], want)
+	}
+}
+
+func TestLDAPLookupAmbiguousUser(t *testing.T) {
+	server := newLDAPStandIn(t, false)
+	authenticator := newTestLDAPAuthenticator(server)
+
+	_, err := authenticator.lookup("twin", "twin-pass")
+	if err == nil || errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("err = %v, want ambiguous entry error", err)
+	}
+}
+
+func TestLDAPLookupServiceBindFailure(t *testing.T) {
+	server := newLDAPStandIn(t, false)
+	authenticator := newTestLDAPAuthenticator(server)
+	authenticator.cfg.BindPassword = "wrong"
+
+	// 服务账号配置错误不是用户的密码错误
+	_, err := authenticator.lookup("alice", "alice-pass")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("err = %v, want service bind error", err)
+	}
+}
+
+func TestLDAPLookupAnonymousSearch(t *testing.T) {
+	server := newLDAPStandIn(t, true)
+	authenticator := newTestLDAPAuthenticator(server)
+	authenticator.cfg.BindDN = ""
+	authenticator.cfg.BindPassword = ""
+
+	entry, err := authenticator.lookup("alice", "alice-pass")
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if want := []string{"ops", "developers"}; !reflect.DeepEqual(entry.Groups, want) {
+		t.Errorf("groups = %v, want %v", entry.Groups, want)
+	}
+	if want := []string{"", testAliceDN, ""}; !reflect.DeepEqual(server.recorded(&server.binds), want) {
+		t.Errorf("binds = %v, want %v", server.recorded(&server.binds), want)
+	}
+}
+
+func TestLDAPLookupConnectionRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	url := "ldap://" + listener.Addr().String()
+	listener.Close()
+
+	authenticator := NewLDAPAuthenticator(config.LDAPConfig{URL: url, Timeout: 1})
+	if _, err := authenticator.lookup("alice", "alice-pass"); err == nil {
+		t.Fatal("lookup succeeded without a server")
+	}
+}
+
+func TestGroupNameFromDN(t *testing.T) {
+	tests := []struct {
+		dn   string
+		want string
+	}{
+		{"cn=admins,ou=groups,dc=example,dc=com", "admins"},
+		{"CN=Domain Admins,CN=Users,DC=corp,DC=local", "Domain Admins"},
+		{"cn=a\\,b,ou=groups", "a,b"},
+		{"not a dn", "not a dn"},
+	}
+	for _, tt := range tests {
+		if got := groupNameFromDN(tt.dn); got != tt.want {
+			t.Errorf("groupNameFromDN(%q) = %q, want %q", tt.dn, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"ft-backend/common/config"
+	"ft-backend/common/logger"
+)
+
+// GlobalMailer 全局邮件发送器
+var GlobalMailer Mailer
+
+// Mailer 邮件发送接口，便于替换为其他实现
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPMailer 基于SMTP的邮件发送器
+type SMTPMailer struct {
+	cfg config.MailConfig
+}
+
+// LogMailer 未配置SMTP时使用，只记录收件人和主题，不发送邮件
+type LogMailer struct{}
+
+// NewMailer 根据配置创建邮件发送器，未配置SMTP主机时使用LogMailer
+func NewMailer(cfg config.MailConfig) Mailer {
+	if cfg.Host == "" {
+		logger.Warn("未配置SMTP服务器，邮件不会发送，只记录收件人和主题")
+		return &LogMailer{}
+	}
+	return &SMTPMailer{cfg: cfg}
+}
+
+// Send 通过SMTP发送纯文本邮件
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	port := m.cfg.Port
+	if port == "" {
+		port = "25"
+	}
+	addr := net.JoinHostPort(m.cfg.Host, port)
+
+	// 未配置用户名时不做认证，便于对接本地SMTP测试服务
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+
+	msg := strings.Join([]string{
+		fmt.Sprintf("From: %s", m.cfg.From),
+		fmt.Sprintf("To: %s", to),
+		fmt.Sprintf("Subject: %s", subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	if err := smtp.SendMail(addr, auth, m.cfg.From, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+// Send 只记录收件人和主题，正文可能包含密码重置链接等凭据，不写入日志
+func (m *LogMailer) Send(to, subject, body string) error {
+	logger.Info("Mail to %s not sent (SMTP not configured), subject: %s", to, subject)
+	return nil
+}
@@ -0,0 +1,221 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"ft-backend/common/config"
+	"ft-backend/common/logger"
+)
+
+// smtpMessage 本地SMTP测试服务收到的邮件
+type smtpMessage struct {
+	auth string // AUTH PLAIN解码后的凭据
+	from string
+	to   []string
+	data string
+}
+
+// smtpStandIn 只实现发送一封邮件所需命令的本地SMTP服务
+type smtpStandIn struct {
+	listener net.Listener
+	withAuth bool
+	mutex    sync.Mutex
+	messages []smtpMessage
+}
+
+func newSMTPStandIn(t *testing.T, withAuth bool) *smtpStandIn {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := &smtpStandIn{listener: listener, withAuth: withAuth}
+	t.Cleanup(func() { listener.Close() })
+	go server.serve()
+	return server
+}
+
+func (s *smtpStandIn) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	var message smtpMessage
+	reply("220 localhost ESMTP stand-in")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			if s.withAuth {
+				reply("250-localhost")
+				reply("250 AUTH PLAIN")
+			} else {
+				reply("250 localhost")
+			}
+		case strings.HasPrefix(command, "AUTH PLAIN "):
+			decoded, _ := base64.StdEncoding.DecodeString(line[len("AUTH PLAIN "):])
+			message.auth = string(decoded)
+			reply("235 2.7.0 Authentication successful")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			message.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			message.to = append(message.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			message.data = data.String()
+			s.mutex.Lock()
+			s.messages = append(s.messages, message)
+			s.mutex.Unlock()
+			message = smtpMessage{}
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *smtpStandIn) port() string {
+	return strconv.Itoa(s.listener.Addr().(*net.TCPAddr).Port)
+}
+
+func (s *smtpStandIn) received() []smtpMessage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]smtpMessage(nil), s.messages...)
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	server := newSMTPStandIn(t, false)
+	mailer := NewMailer(config.MailConfig{
+		Host: "127.0.0.1",
+		Port: server.port(),
+		From: "noreply@example.com",
+	})
+	if _, ok := mailer.(*SMTPMailer); !ok {
+		t.Fatalf("NewMailer returned %T, want *SMTPMailer", mailer)
+	}
+
+	body := "Reset link: https://ft.example.com/reset?token=abc123"
+	if err := mailer.Send("alice@example.com", "Password reset", body); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	messages := server.received()
+	if len(messages) != 1 {
+		t.Fatalf("received %d messages, want 1", len(messages))
+	}
+	message := messages[0]
+	if message.from != "noreply@example.com" {
+		t.Errorf("MAIL FROM = %q", message.from)
+	}
+	if len(message.to) != 1 || message.to[0] != "alice@example.com" {
+		t.Errorf("RCPT TO = %v", message.to)
+	}
+	if message.auth != "" {
+		t.Errorf("unexpected AUTH without username: %q", message.auth)
+	}
+	for _, want := range []string{"To: alice@example.com", "Subject: Password reset", "Content-Type: text/plain; charset=UTF-8", body} {
+		if !strings.Contains(message.data, want) {
+			t.Errorf("message data missing %q:\n%s", want, message.data)
+		}
+	}
+}
+
+func TestSMTPMailerSendWithAuth(t *testing.T) {
+	server := newSMTPStandIn(t, true)
+	mailer := NewMailer(config.MailConfig{
+		Host:     "127.0.0.1",
+		Port:     server.port(),
+		Username: "mailer",
+		Password: "secret",
+		From:     "noreply@example.com",
+	})
+
+	if err := mailer.Send("bob@example.com", "Hello", "body"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	messages := server.received()
+	if len(messages) != 1 {
+		t.Fatalf("received %d messages, want 1", len(messages))
+	}
+	if messages[0].auth != "\x00mailer\x00secret" {
+		t.Errorf("AUTH PLAIN credentials = %q", messages[0].auth)
+	}
+}
+
+func TestSMTPMailerSendConnectionRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	listener.Close()
+
+	mailer := NewMailer(config.MailConfig{Host: "127.0.0.1", Port: port, From: "noreply@example.com"})
+	if err := mailer.Send("alice@example.com", "subject", "body"); err == nil {
+		t.Fatal("Send succeeded without a server")
+	}
+}
+
+func TestLogMailerDoesNotLogBody(t *testing.T) {
+	var output bytes.Buffer
+	logger.InitLogger("debug", &output)
+	defer logger.InitLogger("error", io.Discard)
+
+	mailer := NewMailer(config.MailConfig{})
+	if _, ok := mailer.(*LogMailer); !ok {
+		t.Fatalf("NewMailer without host returned %T, want *LogMailer", mailer)
+	}
+	if err := mailer.Send("alice@example.com", "Password reset", "token=supersecret"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	logged := output.String()
+	if strings.Contains(logged, "supersecret") {
+		t.Errorf("mail body was logged: %s", logged)
+	}
+	if !strings.Contains(logged, "alice@example.com") || !strings.Contains(logged, "Password reset") {
+		t.Errorf("recipient or subject missing from log: %s", logged)
+	}
+}
@@ -0,0 +1,14 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"ft-backend/common/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitLogger("error", io.Discard)
+	os.Exit(m.Run())
+}
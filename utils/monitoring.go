@@ -3,48 +3,162 @@ package utils
 import (
 	"time"
 
+	"ft-backend/common/config"
 	"ft-backend/common/logger"
 	"ft-backend/database"
 	"ft-backend/models"
 )
 
-// StartMachineStatusMonitor 启动机器状态监控器
-func StartMachineStatusMonitor() {
+// 机器状态
+const (
+	MachineOnline   = "online"
+	MachineDegraded = "degraded"
+	MachineOffline  = "offline"
+)
+
+// 状态变更原因
+const (
+	StatusReasonHeartbeat = "heartbeat"
+	StatusReasonManual    = "manual"
+)
+
+// StartMachineStatusMonitor 启动机器状态监控器，按关联代理的心跳推算机器状态
+func StartMachineStatusMonitor(cfg config.AgentConfig) {
+	degradedAfter := time.Duration(cfg.DegradedAfter) * time.Second
+	if degradedAfter <= 0 {
+		degradedAfter = 90 * time.Second
+	}
+	offlineAfter := time.Duration(cfg.OfflineAfter) * time.Second
+	if offlineAfter <= degradedAfter {
+		offlineAfter = degradedAfter * 2
+	}
+
 	// 每5秒检查一次机器状态
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
-	logger.Info("Machine status monitor started")
+	logger.Info("Machine status monitor started, degraded after %v, offline after %v", degradedAfter, offlineAfter)
 
 	for range ticker.C {
 		// 检查机器状态
-		checkMachineStatus()
+		checkMachineStatus(degradedAfter, offlineAfter)
 	}
 
 }
 
-// checkMachineStatus 检查所有机器的状态并广播更新
-func checkMachineStatus() {
-	// 获取所有机器
+// heartbeatStatus 根据最后一次心跳距今的时间推算状态
+func heartbeatStatus(lastSeen time.Time, degradedAfter, offlineAfter time.Duration) string {
+	age := time.Since(lastSeen)
+	switch {
+	case age <= degradedAfter:
+		return MachineOnline
+	case age <= offlineAfter:
+		return MachineDegraded
+	default:
+		return MachineOffline
+	}
+}
+
+// checkMachineStatus 检查有代理关联的机器状态，只推送状态实际发生变化的机器。
+// 没有关联代理的机器保持手动设置的状态
+func checkMachineStatus(degradedAfter, offlineAfter time.Duration) {
+	var freshness []struct {
+		MachineID uint
+		LastSeen  time.Time
+	}
+	if err := database.DB.Model(&models.Agent{}).
+		Select("machine_id, MAX(last_seen_at) AS last_seen").
+		Where("machine_id IS NOT NULL").
+		Group("machine_id").
+		Scan(&freshness).Error; err != nil {
+		logger.Error("Failed to get agent heartbeats: %v", err)
+		return
+	}
+	if len(freshness) == 0 {
+		return
+	}
+
+	lastSeen := make(map[uint]time.Time, len(freshness))
+	ids := make([]uint, 0, len(freshness))
+	for _, item := range freshness {
+		lastSeen[item.MachineID] = item.LastSeen
+		ids = append(ids, item.MachineID)
+	}
+
 	var machines []models.Machine
-	result := database.DB.Find(&machines)
-	if result.Error != nil {
-		logger.Error("Failed to get machines: %v", result.Error)
+	if err := database.DB.Where("id IN ? AND deleted_at IS NULL", ids).Find(&machines).Error; err != nil {
+		logger.Error("Failed to get machines: %v", err)
 		return
 	}
 
-	// 这里可以添加实际的状态检查逻辑
-	// 例如，通过ping检查机器是否在线
-	// 为了演示目的，我们随机改变一些机器的状态
+	var changed []models.Machine
+	for _, machine := range machines {
+		status := heartbeatStatus(lastSeen[machine.ID], degradedAfter, offlineAfter)
+		if status == machine.Status {
+			continue
+		}
+		ok, err := TransitionMachineStatus(&machine, status, StatusReasonHeartbeat, "")
+		if err != nil {
+			logger.Error("Failed to update machine %d status: %v", machine.ID, err)
+			continue
+		}
+		if ok {
+			changed = append(changed, machine)
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
 
-	// 广播机器状态更新
-	statusUpdateMsg := WebSocketMessage{
+	// 推送状态变化的机器，多实例部署时只有完成状态更新的实例推送。
+	// 列表主题的消息只包含本次变化的机器，不能合并；单机主题的消息是该机器的完整状态，可以合并
+	GlobalWebSocketManager.PublishUnkeyed(TopicMachines, WebSocketMessage{
 		Type:    "machine_status_update",
 		Message: "Machine status updated",
-		Data:    machines,
+		Data:    changed,
+	})
+	for _, machine := range changed {
+		GlobalWebSocketManager.Publish(MachineTopic(machine.ID), WebSocketMessage{
+			Type:    "machine_status_update",
+			Message: "Machine status updated",
+			Data:    machine,
+		})
+	}
+
+	logger.Info("Machine status changed for %d machines", len(changed))
+}
+
+// TransitionMachineStatus 将机器从当前状态变更为status并记录变更，
+// 以当前状态为条件更新，并发更新时只有一方成功，返回false表示状态已被其他请求修改
+func TransitionMachineStatus(machine *models.Machine, status, reason, operator string) (bool, error) {
+	now := time.Now()
+	result := database.DB.Model(&models.Machine{}).
+		Where("id = ? AND status = ?", machine.ID, machine.Status).
+		Updates(map[string]interface{}{"status": status, "status_changed_at": now})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
 	}
 
-	GlobalWebSocketManager.Broadcast(statusUpdateMsg)
+	RecordMachineStatusChange(machine.ID, machine.Status, status, reason, operator, now)
+	machine.Status = status
+	machine.StatusChangedAt = &now
+	return true, nil
+}
 
-	logger.Debug("Broadcasted machine status update to %d machines", len(machines))
-}
\ No newline at end of file
+// RecordMachineStatusChange 记录机器状态变更，失败时只记录日志
+func RecordMachineStatusChange(machineID uint, from, to, reason, operator string, changedAt time.Time) {
+	change := models.MachineStatusChange{
+		MachineID:  machineID,
+		FromStatus: from,
+		ToStatus:   to,
+		Reason:     reason,
+		Operator:   operator,
+		ChangedAt:  changedAt,
+	}
+	if err := database.DB.Create(&change).Error; err != nil {
+		logger.Error("Failed to record machine %d status change: %v", machineID, err)
+	}
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"ft-backend/common/logger"
+	"ft-backend/database"
+	"ft-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxReplayBatch 单次补发的最大通知数，避免补发时撑满连接的发送队列
+const maxReplayBatch = 100
+
+// NotifyUser 持久化通知并推送给用户当前的连接，离线用户重新连接后可按序号补发
+func NotifyUser(userID uint, message WebSocketMessage) (*models.Notification, error) {
+	notification := models.Notification{
+		UserID:  userID,
+		Type:    message.Type,
+		Message: message.Message,
+	}
+	if message.Data != nil {
+		data, err := json.Marshal(message.Data)
+		if err != nil {
+			return nil, err
+		}
+		notification.Data = data
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定用户行，同一用户的序号串行分配
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, userID).Error; err != nil {
+			return err
+		}
+		var lastSeq uint64
+		if err := tx.Model(&models.Notification{}).Where("user_id = ?", userID).Select("COALESCE(MAX(seq), 0)").Scan(&lastSeq).Error; err != nil {
+			return err
+		}
+		notification.Seq = lastSeq + 1
+		return tx.Create(&notification).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if GlobalWebSocketManager != nil {
+		clientID := strconv.FormatUint(uint64(userID), 10)
+		if err := GlobalWebSocketManager.SendToClient(clientID, notificationMessage(notification)); err != nil {
+			logger.Warn("Failed to push notification %d to user %d: %v", notification.ID, userID, err)
+		}
+	}
+	return &notification, nil
+}
+
+// notificationMessage 将通知转换为WebSocket消息
+func notificationMessage(notification models.Notification) WebSocketMessage {
+	message := WebSocketMessage{
+		Type:    notification.Type,
+		Seq:     notification.Seq,
+		Message: notification.Message,
+	}
+	if len(notification.Data) > 0 {
+		message.Data = notification.Data
+	}
+	return message
+}
+
+// notificationsSince 按序号顺序查询用户序号大于since的通知
+func notificationsSince(userID string, since uint64, limit int) ([]models.Notification, error) {
+	var notifications []models.Notification
+	err := database.DB.Where("user_id = ? AND seq > ?", userID, since).Order("seq").Limit(limit).Find(&notifications).Error
+	return notifications, err
+}
+
+// replay 补发序号大于since的通知，more为true时客户端应以最后的序号继续请求。
+// 补发期间产生的新通知可能重复到达，客户端按序号去重
+func (client *WebSocketClient) replay(requestID string, since uint64) {
+	batch := maxReplayBatch
+	if half := client.Manager.queueSize / 2; half < batch {
+		batch = half
+	}
+
+	notifications, err := notificationsSince(client.ID, since, batch+1)
+	if err != nil {
+		logger.Error("Failed to load notifications for replay: %v", err)
+		client.reply(WebSocketMessage{Type: "error", ID: requestID, Message: "replay failed"})
+		return
+	}
+
+	more := len(notifications) > batch
+	if more {
+		notifications = notifications[:batch]
+	}
+	lastSeq := since
+	for _, notification := range notifications {
+		client.reply(notificationMessage(notification))
+		lastSeq = notification.Seq
+	}
+
+	client.reply(WebSocketMessage{
+		Type:    "ack",
+		ID:      requestID,
+		Message: "replayed",
+		Data: map[string]interface{}{
+			"count":    len(notifications),
+			"last_seq": lastSeq,
+			"more":     more,
+		},
+	})
+}
@@ -0,0 +1,437 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"ft-backend/common/config"
+	"ft-backend/common/logger"
+	"ft-backend/database"
+	"ft-backend/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// GlobalOIDCProvider 全局OIDC提供方，未启用单点登录时为nil
+var GlobalOIDCProvider *OIDCProvider
+
+const (
+	// oidcSessionTTL 从跳转登录到回调的最长时间
+	oidcSessionTTL = 10 * time.Minute
+	// jwksMinRefreshInterval 遇到未知kid时重新拉取JWKS的最小间隔
+	jwksMinRefreshInterval = time.Minute
+	// oidcMaxSessions 同时进行中的登录流程上限，登录入口无需认证，避免被刷满
+	oidcMaxSessions = 10000
+)
+
+// errTooManyOIDCSessions 进行中的登录流程超过上限
+var errTooManyOIDCSessions = errors.New("too many pending oidc logins")
+
+// OIDCProvider OpenID Connect授权码+PKCE登录流程
+type OIDCProvider struct {
+	cfg    config.OIDCConfig
+	client *http.Client
+
+	sessions oidcSessionStore
+
+	mutex         sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+// OIDCIdentity 从ID Token中解析出的用户身份
+type OIDCIdentity struct {
+	Issuer   string
+	Subject  string // 与Issuer一起唯一标识用户，Username可能被修改或回收
+	Username string
+	Email    string
+	FullName string
+	Groups   []string
+}
+
+// oidcDiscovery 发现文档中需要的字段
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcSession 一次登录流程的state对应的nonce和PKCE校验码
+type oidcSession struct {
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// oidcSessionStore 按state的哈希保存登录流程，多实例部署时各实例必须共享
+type oidcSessionStore interface {
+	save(stateHash string, session oidcSession) error
+	// take 取出并删除登录流程，不存在或已被使用时返回false
+	take(stateHash string) (oidcSession, bool, error)
+}
+
+// dbOIDCSessionStore 保存在oidc_sessions表中的登录流程
+type dbOIDCSessionStore struct{}
+
+func (dbOIDCSessionStore) save(stateHash string, session oidcSession) error {
+	if err := database.DB.Where("expires_at <= ?", time.Now()).Delete(&models.OIDCSession{}).Error; err != nil {
+		return err
+	}
+	var count int64
+	if err := database.DB.Model(&models.OIDCSession{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count >= oidcMaxSessions {
+		return errTooManyOIDCSessions
+	}
+	return database.DB.Create(&models.OIDCSession{
+		StateHash:    stateHash,
+		Nonce:        session.Nonce,
+		CodeVerifier: session.CodeVerifier,
+		ExpiresAt:    session.ExpiresAt,
+	}).Error
+}
+
+func (dbOIDCSessionStore) take(stateHash string) (oidcSession, bool, error) {
+	var record models.OIDCSession
+	if err := database.DB.Where("state_hash = ?", stateHash).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return oidcSession{}, false, nil
+		}
+		return oidcSession{}, false, err
+	}
+
+	// 只有删除成功的回调可以继续，多个实例同时收到同一state时只有一个成功
+	result := database.DB.Delete(&models.OIDCSession{}, record.ID)
+	if result.Error != nil {
+		return oidcSession{}, false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return oidcSession{}, false, nil
+	}
+	return oidcSession{Nonce: record.Nonce, CodeVerifier: record.CodeVerifier, ExpiresAt: record.ExpiresAt}, true, nil
+}
+
+// NewOIDCProvider 创建OIDC提供方，发现文档在首次使用时加载
+func NewOIDCProvider(cfg config.OIDCConfig) *OIDCProvider {
+	return &OIDCProvider{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		keys:     make(map[string]crypto.PublicKey),
+		sessions: dbOIDCSessionStore{},
+	}
+}
+
+// AuthCodeURL 生成跳转到身份提供方的授权地址，同时返回state，调用方需将其与发起登录的浏览器绑定
+func (p *OIDCProvider) AuthCodeURL() (authURL, state string, err error) {
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err = GenerateRandomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	session := oidcSession{Nonce: nonce, CodeVerifier: verifier, ExpiresAt: time.Now().Add(oidcSessionTTL)}
+	if err := p.sessions.save(HashToken(state), session); err != nil {
+		return "", "", fmt.Errorf("failed to save oidc session: %w", err)
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	scopes := p.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "profile", "email"}
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.cfg.ClientID)
+	params.Set("redirect_uri", p.cfg.RedirectURL)
+	params.Set("scope", strings.Join(scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return discovery.AuthorizationEndpoint + sep + params.Encode(), state, nil
+}
+
+// Exchange 校验state后用授权码换取ID Token并验证
+func (p *OIDCProvider) Exchange(state, code string) (*OIDCIdentity, error) {
+	session, ok, err := p.sessions.take(HashToken(state))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load oidc session: %w", err)
+	}
+	if !ok || session.ExpiresAt.Before(time.Now()) {
+		return nil, errors.New("invalid or expired state")
+	}
+
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("client_id", p.cfg.ClientID)
+	form.Set("code_verifier", session.CodeVerifier)
+
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tokenResp struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tokenResp.Error != "" {
+		return nil, fmt.Errorf("token endpoint returned %d: %s %s", resp.StatusCode, tokenResp.Error, tokenResp.ErrorDescription)
+	}
+	if tokenResp.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	claims, err := p.verifyIDToken(tokenResp.IDToken, discovery.Issuer, session.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	return p.identityFromClaims(claims)
+}
+
+// verifyIDToken 验证ID Token的签名、签发方、受众、有效期和nonce
+func (p *OIDCProvider) verifyIDToken(idToken, issuer, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.getKey(kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "PS256", "EdDSA"}),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return nil, errors.New("id token nonce mismatch")
+	}
+	// 多受众时azp必须是本客户端
+	if azp, ok := claims["azp"].(string); ok && azp != p.cfg.ClientID {
+		return nil, errors.New("id token azp mismatch")
+	}
+	return claims, nil
+}
+
+// identityFromClaims 按配置的声明名称提取用户信息
+func (p *OIDCProvider) identityFromClaims(claims jwt.MapClaims) (*OIDCIdentity, error) {
+	identity := &OIDCIdentity{}
+	identity.Issuer, _ = claims["iss"].(string)
+	identity.Subject, _ = claims["sub"].(string)
+	if identity.Issuer == "" || identity.Subject == "" {
+		return nil, errors.New("id token has no iss or sub claim")
+	}
+	if len(identity.Issuer) > 191 || len(identity.Subject) > 191 {
+		return nil, errors.New("id token iss or sub claim is too long")
+	}
+	identity.Username = stringClaim(claims, p.cfg.UsernameClaim, "preferred_username")
+	if identity.Username == "" {
+		identity.Username = identity.Subject
+	}
+	if identity.Username == "" {
+		return nil, errors.New("id token has no username claim")
+	}
+	if len(identity.Username) > 50 {
+		return nil, fmt.Errorf("username claim is too long: %s", identity.Username)
+	}
+	identity.Email = stringClaim(claims, p.cfg.EmailClaim, "email")
+	identity.FullName = stringClaim(claims, p.cfg.NameClaim, "name")
+
+	groupsClaim := p.cfg.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	switch groups := claims[groupsClaim].(type) {
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				identity.Groups = append(identity.Groups, s)
+			}
+		}
+	case string:
+		identity.Groups = append(identity.Groups, groups)
+	}
+	return identity, nil
+}
+
+// stringClaim 读取字符串类型的声明，未配置声明名称时使用默认名称
+func stringClaim(claims jwt.MapClaims, name, fallback string) string {
+	if name == "" {
+		name = fallback
+	}
+	value, _ := claims[name].(string)
+	return value
+}
+
+// getDiscovery 获取并缓存发现文档
+func (p *OIDCProvider) getDiscovery() (*oidcDiscovery, error) {
+	p.mutex.Lock()
+	discovery := p.discovery
+	p.mutex.Unlock()
+	if discovery != nil {
+		return discovery, nil
+	}
+
+	issuer := strings.TrimSuffix(p.cfg.IssuerURL, "/")
+	resp, err := p.client.Get(issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch oidc discovery: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc discovery returned %d", resp.StatusCode)
+	}
+
+	discovery = &oidcDiscovery{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(discovery); err != nil {
+		return nil, fmt.Errorf("failed to decode oidc discovery: %w", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("oidc discovery issuer mismatch: %s", discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("oidc discovery document is incomplete")
+	}
+
+	p.mutex.Lock()
+	p.discovery = discovery
+	p.mutex.Unlock()
+	logger.Info("Loaded oidc discovery for %s", discovery.Issuer)
+	return discovery, nil
+}
+
+// getKey 按kid查找签名公钥，找不到时重新拉取JWKS以支持身份提供方轮换密钥
+func (p *OIDCProvider) getKey(kid string) (crypto.PublicKey, error) {
+	p.mutex.Lock()
+	key, ok := p.lookupKey(kid)
+	canRefresh := time.Since(p.keysFetchedAt) > jwksMinRefreshInterval
+	p.mutex.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !canRefresh {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+
+	if err := p.refreshKeys(); err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key: %s", kid)
+}
+
+// lookupKey 在已缓存的公钥中查找，kid为空且只有一个公钥时直接使用，调用方需持有锁
+func (p *OIDCProvider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// refreshKeys 拉取JWKS并替换缓存的公钥
+func (p *OIDCProvider) refreshKeys() error {
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Get(discovery.JWKSURI)
+	if err != nil {
+		return fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwks endpoint returned %d", resp.StatusCode)
+	}
+
+	var set JWKSet
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			logger.Warn("Skip jwk %s: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	p.mutex.Lock()
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+	p.mutex.Unlock()
+	logger.Debug("Loaded %d oidc signing keys", len(keys))
+	return nil
+}
@@ -0,0 +1,521 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ft-backend/common/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testOIDCClientID     = "ft-backend"
+	testOIDCClientSecret = "client-secret"
+	testOIDCRedirectURL  = "https://ft.example.com/api/auth/oidc/callback"
+)
+
+// oidcGrant 授权端点记录的一次授权，令牌端点凭授权码取回
+type oidcGrant struct {
+	challenge string
+	nonce     string
+}
+
+// oidcIssuerStandIn 提供发现文档、JWKS和令牌端点的本地OIDC身份提供方
+type oidcIssuerStandIn struct {
+	server *httptest.Server
+
+	mutex  sync.Mutex
+	key    *rsa.PrivateKey
+	kid    string
+	grants map[string]oidcGrant
+	// claims 修改签发的ID Token声明，用于构造异常令牌
+	claims func(jwt.MapClaims)
+	// sign 替换默认的RS256签名，用于构造错误签名的令牌
+	sign func(claims jwt.MapClaims) string
+}
+
+func newOIDCIssuerStandIn(t *testing.T) *oidcIssuerStandIn {
+	t.Helper()
+	issuer := &oidcIssuerStandIn{grants: make(map[string]oidcGrant)}
+	issuer.rotateKey(t, "key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                issuer.server.URL,
+			AuthorizationEndpoint: issuer.server.URL + "/authorize",
+			TokenEndpoint:         issuer.server.URL + "/token",
+			JWKSURI:               issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", issuer.handleJWKS)
+	mux.HandleFunc("/token", issuer.handleToken)
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// rotateKey 生成新的签名密钥，JWKS只发布新公钥
+func (i *oidcIssuerStandIn) rotateKey(t *testing.T, kid string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	i.mutex.Lock()
+	i.key = key
+	i.kid = kid
+	i.mutex.Unlock()
+}
+
+func (i *oidcIssuerStandIn) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	i.mutex.Lock()
+	key, kid := i.key, i.kid
+	i.mutex.Unlock()
+
+	json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+}
+
+// authorize 模拟用户在身份提供方登录：校验授权地址参数并签发授权码
+func (i *oidcIssuerStandIn) authorize(t *testing.T, authURL string) (state, code string) {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse auth url: %v", err)
+	}
+	if !strings.HasPrefix(authURL, i.server.URL+"/authorize?") {
+		t.Fatalf("auth url %s does not use the discovered endpoint", authURL)
+	}
+	params := parsed.Query()
+	for name, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             testOIDCClientID,
+		"redirect_uri":          testOIDCRedirectURL,
+		"scope":                 "openid profile email",
+		"code_challenge_method": "S256",
+	} {
+		if got := params.Get(name); got != want {
+			t.Errorf("auth url %s = %q, want %q", name, got, want)
+		}
+	}
+	if params.Get("state") == "" || params.Get("nonce") == "" || params.Get("code_challenge") == "" {
+		t.Fatalf("auth url is missing state, nonce or code_challenge: %s", authURL)
+	}
+
+	code = "code-" + params.Get("state")
+	i.mutex.Lock()
+	i.grants[code] = oidcGrant{challenge: params.Get("code_challenge"), nonce: params.Get("nonce")}
+	i.mutex.Unlock()
+	return params.Get("state"), code
+}
+
+func (i *oidcIssuerStandIn) handleToken(w http.ResponseWriter, r *http.Request) {
+	fail := func(code string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || clientID != testOIDCClientID || clientSecret != testOIDCClientSecret {
+		fail("invalid_client")
+		return
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != testOIDCRedirectURL {
+		fail("invalid_request")
+		return
+	}
+
+	// 授权码只能使用一次
+	i.mutex.Lock()
+	grant, ok := i.grants[r.PostFormValue("code")]
+	delete(i.grants, r.PostFormValue("code"))
+	key, kid, mutate, sign := i.key, i.kid, i.claims, i.sign
+	i.mutex.Unlock()
+	if !ok {
+		fail("invalid_grant")
+		return
+	}
+
+	// PKCE：code_verifier 的 SHA-256 必须与授权时的 code_challenge 一致
+	digest := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(digest[:]) != grant.challenge {
+		fail("invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":                i.server.URL,
+		"aud":                testOIDCClientID,
+		"sub":                "00u1a2b3c",
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              grant.nonce,
+		"preferred_username": "alice",
+		"email":              "alice@example.com",
+		"name":               "Alice Liu",
+		"groups":             []string{"staff", "ft-admins"},
+	}
+	if mutate != nil {
+		mutate(claims)
+	}
+
+	var idToken string
+	if sign != nil {
+		idToken = sign(claims)
+	} else {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = kid
+		idToken, _ = token.SignedString(key)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "opaque",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func (i *oidcIssuerStandIn) setClaims(mutate func(jwt.MapClaims)) {
+	i.mutex.Lock()
+	i.claims = mutate
+	i.mutex.Unlock()
+}
+
+func (i *oidcIssuerStandIn) setSign(sign func(jwt.MapClaims) string) {
+	i.mutex.Lock()
+	i.sign = sign
+	i.mutex.Unlock()
+}
+
+// memoryOIDCSessionStore 测试用的内存登录流程存储，代替oidc_sessions表
+type memoryOIDCSessionStore struct {
+	mutex    sync.Mutex
+	sessions map[string]oidcSession
+}
+
+func (store *memoryOIDCSessionStore) save(stateHash string, session oidcSession) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.sessions[stateHash] = session
+	return nil
+}
+
+func (store *memoryOIDCSessionStore) take(stateHash string) (oidcSession, bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	session, ok := store.sessions[stateHash]
+	delete(store.sessions, stateHash)
+	return session, ok, nil
+}
+
+// update 修改保存的登录流程，用于构造过期或被篡改的流程
+func (store *memoryOIDCSessionStore) update(t *testing.T, state string, modify func(*oidcSession)) {
+	t.Helper()
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	session, ok := store.sessions[HashToken(state)]
+	if !ok {
+		t.Fatalf("no session stored for state %s", state)
+	}
+	modify(&session)
+	store.sessions[HashToken(state)] = session
+}
+
+func newTestOIDCProvider(issuer *oidcIssuerStandIn) (*OIDCProvider, *memoryOIDCSessionStore) {
+	provider := NewOIDCProvider(config.OIDCConfig{
+		Enabled:      true,
+		IssuerURL:    issuer.server.URL + "/",
+		ClientID:     testOIDCClientID,
+		ClientSecret: testOIDCClientSecret,
+		RedirectURL:  testOIDCRedirectURL,
+	})
+	store := &memoryOIDCSessionStore{sessions: make(map[string]oidcSession)}
+	provider.sessions = store
+	return provider, store
+}
+
+// startLogin 生成授权地址并模拟用户在身份提供方登录
+func startLogin(t *testing.T, provider *OIDCProvider, issuer *oidcIssuerStandIn) (state, code string) {
+	t.Helper()
+	authURL, state, err := provider.AuthCodeURL()
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	urlState, code := issuer.authorize(t, authURL)
+	if urlState != state {
+		t.Fatalf("AuthCodeURL returned state %q, auth url carries %q", state, urlState)
+	}
+	return state, code
+}
+
+// login 走完一次跳转登录和回调
+func login(t *testing.T, provider *OIDCProvider, issuer *oidcIssuerStandIn) (*OIDCIdentity, error) {
+	t.Helper()
+	state, code := startLogin(t, provider, issuer)
+	return provider.Exchange(state, code)
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	issuer := newOIDCIssuerStandIn(t)
+	provider, _ := newTestOIDCProvider(issuer)
+
+	identity, err := login(t, provider, issuer)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := &OIDCIdentity{
+		Issuer:   issuer.server.URL,
+		Subject:  "00u1a2b3c",
+		Username: "alice",
+		Email:    "alice@example.com",
+		FullName: "Alice Liu",
+		Groups:   []string{"staff", "ft-admins"},
+	}
+	if !reflect.DeepEqual(identity, want) {
+		t.Errorf("identity = %+v, want %+v", identity, want)
+	}
+}
+
+func TestOIDCExchangeRejectsReusedState(t *testing.T) {
+	issuer := newOIDCIssuerStandIn(t)
+	provider, _ := newTestOIDCProvider(issuer)
+
+	state, code := startLogin(t, provider, issuer)
+	if _, err := provider.Exchange(state, code); err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if _, err := provider.Exchange(state, code); err == nil {
+		t.Error("state was accepted twice")
+	}
+	if _, err := provider.Exchange("forged-state", code); err == nil {
+		t.Error("unknown state was accepted")
+	}
+}
+
+func TestOIDCSessionStoredByStateHash(t *testing.T) {
+	issuer := newOIDCIssuerStandIn(t)
+	provider, store := newTestOIDCProvider(issuer)
+
+	state, _ := startLogin(t, provider, issuer)
+	store.mutex.Lock()
+	_, raw := store.sessions[state]
+	_, hashed := store.sessions[HashToken(state)]
+	store.mutex.Unlock()
+	if raw || !hashed {
+		t.Errorf("session stored under raw state = %v, under state hash = %v", raw, hashed)
+	}
+}
+
+func TestOIDCExchangeRejectsExpiredState(t *testing.T) {
+	issuer := newOIDCIssuerStandIn(t)
+	provider, store := newTestOIDCProvider(issuer)
+
+	state, code := startLogin(t, provider, issuer)
+	store.update(t, state, func(session *oidcSession) { session.ExpiresAt = time.Now().Add(-time.Second) })
+
+	if _, err := provider.Exchange(state, code); err == nil {
+		t.Error("expired state was accepted")
+	}
+}
+
+func TestOIDCExchangeRejectsCodeVerifierMismatch(t *testing.T) {
+	issuer := newOIDCIssuerStandIn(t)
+	provider, store := newTestOIDCProvider(issuer)
+
+	state, code := startLogin(t, provider, issuer)
+
+	// 授权码被截获后，没有本次登录的 code_verifier 无法换取令牌
+	store.update(t, state, func(session *oidcSession) { session.CodeVerifier = "intercepted" })
+
+	if _, err := provider.Exchange(state, code); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("err = %v, want invalid_grant from token endpoint", err)
+	}
+}
+
+func TestOIDCExchangeRejectsInvalidIDToken(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		claims func(jwt.MapClaims)
+		sign   func(jwt.MapClaims) string
+	}{
+		{name: "nonce mismatch", claims: func(c jwt.MapClaims) { c["nonce"] = "replayed" }},
+		{name: "missing nonce", claims: func(c jwt.MapClaims) { delete(c, "nonce") }},
+		{name: "other audience", claims: func(c jwt.MapClaims) { c["aud"] = "other-client" }},
+		{name: "other issuer", claims: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{name: "expired", claims: func(c jwt.MapClaims) {
+			c["iat"] = time.Now().Add(-time.Hour).Unix()
+			c["exp"] = time.Now().Add(-10 * time.Minute).Unix()
+		}},
+		{name: "missing exp", claims: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "azp of another client", claims: func(c jwt.MapClaims) {
+			c["aud"] = []string{testOIDCClientID, "other-client"}
+			c["azp"] = "other-client"
+		}},
+		{name: "signed by unknown key", sign: func(c jwt.MapClaims) string {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, c)
+			token.Header["kid"] = "key-1"
+			signed, _ := token.SignedString(otherKey)
+			return signed
+		}},
+		{name: "hmac signed", sign: func(c jwt.MapClaims) string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, c)
+			signed, _ := token.SignedString([]byte(testOIDCClientSecret))
+			return signed
+		}},
+		{name: "unsigned", sign: func(c jwt.MapClaims) string {
+			signed, _ := jwt.NewWithClaims(jwt.SigningMethodNone, c).SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return signed
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := newOIDCIssuerStandIn(t)
+			issuer.setClaims(tt.claims)
+			issuer.setSign(tt.sign)
+			provider, _ := newTestOIDCProvider(issuer)
+
+			if identity, err := login(t, provider, issuer); err == nil {
+				t.Errorf("id token was accepted: %+v", identity)
+			}
+		})
+	}
+}
+
+func TestOIDCRefreshesKeysAfterRotation(t *testing.T) {
+	issuer := newOIDCIssuerStandIn(t)
+	provider, _ := newTestOIDCProvider(issuer)
+
+	if _, err := login(t, provider, issuer); err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+
+	// 刚拉取过JWKS时不会因为未知kid反复请求身份提供方
+	issuer.rotateKey(t, "key-2")
+	if _, err := login(t, provider, issuer); err == nil {
+		t.Fatal("unknown kid was accepted before the refresh interval elapsed")
+	}
+
+	provider.mutex.Lock()
+	provider.keysFetchedAt = time.Now().Add(-2 * jwksMinRefreshInterval)
+	provider.mutex.Unlock()
+	if _, err := login(t, provider, issuer); err != nil {
+		t.Fatalf("login after rotation: %v", err)
+	}
+}
+
+func TestOIDCDiscoveryIssuerMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                "https://evil.example.com",
+			AuthorizationEndpoint: "https://evil.example.com/authorize",
+			TokenEndpoint:         "https://evil.example.com/token",
+			JWKSURI:               "https://evil.example.com/jwks",
+		})
+	}))
+	defer server.Close()
+
+	provider := NewOIDCProvider(config.OIDCConfig{IssuerURL: server.URL, ClientID: testOIDCClientID})
+	if _, _, err := provider.AuthCodeURL(); err == nil {
+		t.Error("discovery document of another issuer was accepted")
+	}
+}
+
+func TestOIDCIdentityFromClaims(t *testing.T) {
+	const testIssuer = "https://idp.example.com"
+	tests := []struct {
+		name    string
+		cfg     config.OIDCConfig
+		claims  jwt.MapClaims
+		want    *OIDCIdentity
+		wantErr bool
+	}{
+		{
+			name:   "username falls back to subject",
+			claims: jwt.MapClaims{"iss": testIssuer, "sub": "00u1a2b3c", "groups": "staff"},
+			want:   &OIDCIdentity{Issuer: testIssuer, Subject: "00u1a2b3c", Username: "00u1a2b3c", Groups: []string{"staff"}},
+		},
+		{
+			name: "configured claim names",
+			cfg:  config.OIDCConfig{UsernameClaim: "upn", EmailClaim: "mail", NameClaim: "display_name", GroupsClaim: "roles"},
+			claims: jwt.MapClaims{
+				"iss":          testIssuer,
+				"sub":          "00u1a2b3c",
+				"upn":          "bob",
+				"mail":         "bob@example.com",
+				"display_name": "Bob",
+				"roles":        []interface{}{"ops", 42, "dev"},
+				"groups":       []interface{}{"ignored"},
+			},
+			want: &OIDCIdentity{Issuer: testIssuer, Subject: "00u1a2b3c", Username: "bob", Email: "bob@example.com", FullName: "Bob", Groups: []string{"ops", "dev"}},
+		},
+		{
+			// 用户名可以修改或回收，没有sub无法唯一标识用户
+			name:    "no subject",
+			claims:  jwt.MapClaims{"iss": testIssuer, "preferred_username": "alice"},
+			wantErr: true,
+		},
+		{
+			name:    "no issuer",
+			claims:  jwt.MapClaims{"sub": "00u1a2b3c", "preferred_username": "alice"},
+			wantErr: true,
+		},
+		{
+			name:    "subject too long",
+			claims:  jwt.MapClaims{"iss": testIssuer, "sub": strings.Repeat("s", 192)},
+			wantErr: true,
+		},
+		{
+			name:    "username too long",
+			claims:  jwt.MapClaims{"iss": testIssuer, "sub": "00u1a2b3c", "preferred_username": strings.Repeat("a", 51)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewOIDCProvider(tt.cfg)
+			identity, err := provider.identityFromClaims(tt.claims)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("identity = %+v, want error", identity)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("identityFromClaims: %v", err)
+			}
+			if !reflect.DeepEqual(identity, tt.want) {
+				t.Errorf("identity = %+v, want %+v", identity, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"sync"
+	"time"
+
+	"ft-backend/common/config"
+	"ft-backend/common/logger"
+	"ft-backend/database"
+	"ft-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// GlobalOperationLogger 全局操作日志写入器
+var GlobalOperationLogger *OperationLogger
+
+// OperationLogger 操作日志异步批量写入器，写入时为日志计算链式哈希
+type OperationLogger struct {
+	queue         chan *models.OperationLog
+	batchSize     int
+	flushInterval time.Duration
+	stop          chan struct{}
+	done          chan struct{}
+	mu            sync.RWMutex // 保护stopped，停止后Log不再向队列发送
+	stopped       bool
+}
+
+// NewOperationLogger 创建操作日志写入器
+func NewOperationLogger(cfg config.OperationLogConfig) *OperationLogger {
+	bufferSize := cfg.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = 1024
+	}
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	flushInterval := cfg.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = 2
+	}
+
+	return &OperationLogger{
+		queue:         make(chan *models.OperationLog, bufferSize),
+		batchSize:     batchSize,
+		flushInterval: time.Duration(flushInterval) * time.Second,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// Log 提交一条操作日志，不阻塞请求，队列满或已停止时丢弃
+func (l *OperationLogger) Log(entry *models.OperationLog) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.stopped {
+		logger.Warn("操作日志写入器已停止，丢弃日志: %s %s %s", entry.Username, entry.Method, entry.Path)
+		return
+	}
+
+	select {
+	case l.queue <- entry:
+	default:
+		logger.Warn("操作日志队列已满，丢弃日志: %s %s %s", entry.Username, entry.Method, entry.Path)
+	}
+}
+
+// Start 启动写入循环，达到批量大小或写入间隔时写入数据库。
+// 写入失败时保留这批日志并暂停读取队列，在下一个写入间隔重试，期间队列满后由Log丢弃并告警
+func (l *OperationLogger) Start() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*models.OperationLog, 0, l.batchSize)
+	failed := false
+	for {
+		queue := l.queue
+		if failed || len(batch) >= l.batchSize {
+			queue = nil
+		}
+
+		select {
+		case entry := <-queue:
+			batch = append(batch, entry)
+			if len(batch) >= l.batchSize {
+				failed = !l.flush(batch)
+				if !failed {
+					batch = batch[:0]
+				}
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				failed = !l.flush(batch)
+				if !failed {
+					batch = batch[:0]
+				}
+			}
+		case <-l.stop:
+			// 停止后不会再有新日志进入队列，写入队列中剩余的日志
+			for {
+				select {
+				case entry := <-l.queue:
+					batch = append(batch, entry)
+				default:
+					for attempt := 0; attempt < 3 && len(batch) > 0; attempt++ {
+						if l.flush(batch) {
+							return
+						}
+						time.Sleep(time.Second)
+					}
+					if len(batch) > 0 {
+						logger.Error("停止时写入操作日志失败，丢弃%d条日志", len(batch))
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// Stop 停止接收日志并写入剩余日志。队列不关闭，正在执行的请求调用Log时直接丢弃
+func (l *OperationLogger) Stop() {
+	l.mu.Lock()
+	if !l.stopped {
+		l.stopped = true
+		close(l.stop)
+	}
+	l.mu.Unlock()
+	<-l.done
+}
+
+// flush 在事务中锁定链头，按顺序计算链式哈希后批量写入日志并更新链头。
+// 多实例部署时各实例依次追加到同一条链上，返回是否写入成功
+func (l *OperationLogger) flush(batch []*models.OperationLog) bool {
+	if len(batch) == 0 || database.DB == nil {
+		return true
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		head, err := lockOperationLogChainHead(tx)
+		if err != nil {
+			return err
+		}
+
+		prevHash := head.Hash
+		for _, entry := range batch {
+			// 重试时清除上次失败写入时分配的ID
+			entry.ID = 0
+			entry.CreatedAt = entry.CreatedAt.Truncate(time.Second)
+			entry.PrevHash = prevHash
+			entry.Hash = ComputeOperationLogHash(entry)
+			prevHash = entry.Hash
+		}
+
+		if err := tx.CreateInBatches(batch, l.batchSize).Error; err != nil {
+			return err
+		}
+		return tx.Model(head).Updates(map[string]interface{}{
+			"log_id": batch[len(batch)-1].ID,
+			"hash":   prevHash,
+		}).Error
+	})
+	if err != nil {
+		logger.Error("写入操作日志失败，稍后重试: %v", err)
+		return false
+	}
+	return true
+}
@@ -1,9 +1,33 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"unicode"
+
+	"ft-backend/common/config"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
+// defaultMinPasswordLength 未配置密码策略时的最小长度
+const defaultMinPasswordLength = 6
+
+// temporaryPasswordLength 临时密码的默认长度，密码策略要求更长时按策略
+const temporaryPasswordLength = 16
+
+// 临时密码使用的字符，去掉了容易混淆的字符
+const (
+	passwordUpper   = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	passwordLower   = "abcdefghijkmnopqrstuvwxyz"
+	passwordDigits  = "23456789"
+	passwordSpecial = "#%+-=@_!"
+)
+
 // HashPassword 使用bcrypt对密码进行哈希处理
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -14,4 +38,112 @@ func HashPassword(password string) (string, error) {
 func CheckPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
-}
\ No newline at end of file
+}
+
+// ValidatePasswordStrength 按密码策略校验密码强度
+func ValidatePasswordStrength(password string, policy config.PasswordConfig) error {
+	minLength := policy.MinLength
+	if minLength <= 0 {
+		minLength = defaultMinPasswordLength
+	}
+	if len([]rune(password)) < minLength {
+		return fmt.Errorf("密码长度不能少于%d位", minLength)
+	}
+	// bcrypt只处理前72个字节，超出部分会被忽略
+	if len(password) > 72 {
+		return errors.New("密码长度不能超过72字节")
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSpecial bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSpecial = true
+		}
+	}
+
+	if policy.RequireUpper && !hasUpper {
+		return errors.New("密码必须包含大写字母")
+	}
+	if policy.RequireLower && !hasLower {
+		return errors.New("密码必须包含小写字母")
+	}
+	if policy.RequireDigit && !hasDigit {
+		return errors.New("密码必须包含数字")
+	}
+	if policy.RequireSpecial && !hasSpecial {
+		return errors.New("密码必须包含特殊字符")
+	}
+	return nil
+}
+
+// GenerateRandomToken 生成指定字节数的随机令牌（十六进制编码）
+func GenerateRandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashToken 计算令牌的SHA256哈希，数据库中只保存哈希值
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateTemporaryPassword 按密码策略生成临时密码，包含每一类字符，长度不少于策略要求
+func GenerateTemporaryPassword(policy config.PasswordConfig) (string, error) {
+	length := temporaryPasswordLength
+	if policy.MinLength > length {
+		length = policy.MinLength
+	}
+
+	// 每类字符至少一个，其余从全部字符中随机选取
+	classes := []string{passwordUpper, passwordLower, passwordDigits, passwordSpecial}
+	all := passwordUpper + passwordLower + passwordDigits + passwordSpecial
+	password := make([]byte, 0, length)
+	for _, class := range classes {
+		c, err := randomChar(class)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+	for len(password) < length {
+		c, err := randomChar(all)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+
+	// 打乱顺序，避免固定位置的字符类别
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+
+	if err := ValidatePasswordStrength(string(password), policy); err != nil {
+		return "", fmt.Errorf("password policy cannot be satisfied: %w", err)
+	}
+	return string(password), nil
+}
+
+// randomChar 从字符集中随机取一个字符
+func randomChar(charset string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+	if err != nil {
+		return 0, err
+	}
+	return charset[n.Int64()], nil
+}
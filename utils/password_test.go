@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"testing"
+
+	"ft-backend/common/config"
+)
+
+func TestGenerateTemporaryPassword(t *testing.T) {
+	strict := config.PasswordConfig{RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSpecial: true}
+	tests := []struct {
+		name       string
+		policy     config.PasswordConfig
+		wantLength int
+		wantErr    bool
+	}{
+		{name: "default policy", wantLength: temporaryPasswordLength},
+		{name: "all classes required", policy: strict, wantLength: temporaryPasswordLength},
+		{name: "longer minimum", policy: config.PasswordConfig{MinLength: 40, RequireSpecial: true}, wantLength: 40},
+		{name: "shorter minimum", policy: config.PasswordConfig{MinLength: 8}, wantLength: temporaryPasswordLength},
+		{name: "unsatisfiable minimum", policy: config.PasswordConfig{MinLength: 100}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		password, err := GenerateTemporaryPassword(tt.policy)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: got %q, want error", tt.name, password)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(password) != tt.wantLength {
+			t.Errorf("%s: length = %d, want %d", tt.name, len(password), tt.wantLength)
+		}
+		// 无论配置如何都包含每一类字符
+		if err := ValidatePasswordStrength(password, strict); err != nil {
+			t.Errorf("%s: %q: %v", tt.name, password, err)
+		}
+	}
+
+	first, _ := GenerateTemporaryPassword(strict)
+	second, _ := GenerateTemporaryPassword(strict)
+	if first == second {
+		t.Errorf("two temporary passwords are identical: %q", first)
+	}
+}
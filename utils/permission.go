@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"ft-backend/common/logger"
+	"ft-backend/database"
+	"ft-backend/models"
+)
+
+// GlobalPermissionCache 全局角色权限缓存
+var GlobalPermissionCache = NewPermissionCache()
+
+// permissionCacheTTL 缓存的最长有效期，多实例部署时作为丢失失效通知的兜底
+const permissionCacheTTL = time.Minute
+
+// permissionLoadAttempts 加载期间缓存反复被失效时的最多加载次数
+const permissionLoadAttempts = 5
+
+// errPermissionCacheUnstable 多次加载期间缓存都被失效，无法得到一致的权限数据
+var errPermissionCacheUnstable = errors.New("permission cache invalidated repeatedly while loading")
+
+// PermissionCache 角色→有效权限代码的缓存（包含继承自父角色的权限），
+// 角色或角色权限变更后需要调用Invalidate
+type PermissionCache struct {
+	mutex      sync.RWMutex
+	loaded     bool
+	loadedAt   time.Time
+	generation uint64 // 每次失效时递增，加载期间发生失效时丢弃加载结果
+	roles      map[string]map[string]bool
+	parents    map[string]string // 角色→父角色
+	broker     WebSocketBroker   // 在实例间分发失效通知，为空时只失效本实例
+}
+
+// NewPermissionCache 创建角色权限缓存
+func NewPermissionCache() *PermissionCache {
+	return &PermissionCache{roles: make(map[string]map[string]bool)}
+}
+
+// HasPermission 判断角色是否拥有权限
+func (cache *PermissionCache) HasPermission(role, code string) (bool, error) {
+	if err := cache.ensureLoaded(); err != nil {
+		return false, err
+	}
+
+	cache.mutex.RLock()
+	defer cache.mutex.RUnlock()
+	return cache.roles[role][code], nil
+}
+
+// RoleChain 获取角色及其所有祖先角色
+func (cache *PermissionCache) RoleChain(role string) ([]string, error) {
+	if err := cache.ensureLoaded(); err != nil {
+		return nil, err
+	}
+
+	cache.mutex.RLock()
+	defer cache.mutex.RUnlock()
+	return RoleChain(role, cache.parents), nil
+}
+
+// EffectivePermissions 获取角色的全部有效权限代码
+func (cache *PermissionCache) EffectivePermissions(role string) ([]string, error) {
+	if err := cache.ensureLoaded(); err != nil {
+		return nil, err
+	}
+
+	cache.mutex.RLock()
+	codes := make([]string, 0, len(cache.roles[role]))
+	for code := range cache.roles[role] {
+		codes = append(codes, code)
+	}
+	cache.mutex.RUnlock()
+
+	sort.Strings(codes)
+	return codes, nil
+}
+
+// SubscribeInvalidations 订阅消息代理上的失效通知，之后Invalidate会通过该代理通知所有实例
+func (cache *PermissionCache) SubscribeInvalidations(broker WebSocketBroker) error {
+	if err := broker.Subscribe(func([]byte) { cache.invalidateLocal() }); err != nil {
+		return err
+	}
+	cache.mutex.Lock()
+	cache.broker = broker
+	cache.mutex.Unlock()
+	return nil
+}
+
+// Invalidate 使缓存失效，下次检查时从数据库重新加载，并通过消息代理通知其他实例。
+// 通知发送失败时其他实例最迟在permissionCacheTTL后重新加载
+func (cache *PermissionCache) Invalidate() {
+	cache.invalidateLocal()
+
+	cache.mutex.RLock()
+	broker := cache.broker
+	cache.mutex.RUnlock()
+	if broker == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := broker.Publish(ctx, []byte("invalidate")); err != nil {
+		logger.Error("Failed to publish permission cache invalidation: %v", err)
+	}
+}
+
+// invalidateLocal 标记本实例的缓存已失效，并重新检查本实例的主题订阅。
+// 旧数据保留到重新加载完成，失效期间的检查会等待重新加载，不会读到空缓存
+func (cache *PermissionCache) invalidateLocal() {
+	cache.mutex.Lock()
+	cache.loaded = false
+	cache.generation++
+	cache.mutex.Unlock()
+	logger.Debug("Permission cache invalidated")
+
+	if GlobalWebSocketManager != nil && cache == GlobalPermissionCache {
+		go GlobalWebSocketManager.revalidateLocal()
+	}
+}
+
+// ensureLoaded 缓存未加载或已过期时从数据库加载
+func (cache *PermissionCache) ensureLoaded() error {
+	cache.mutex.RLock()
+	fresh := cache.loaded && time.Since(cache.loadedAt) < permissionCacheTTL
+	cache.mutex.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	// 加载期间缓存被失效时重新加载，避免保存失效前读到的旧数据；
+	// 多次仍不一致时拒绝本次检查，而不是使用可能已过期的数据
+	for attempt := 0; attempt < permissionLoadAttempts; attempt++ {
+		stored, err := cache.load()
+		if err != nil || stored {
+			return err
+		}
+	}
+	logger.Error("加载角色权限失败: %v", errPermissionCacheUnstable)
+	return errPermissionCacheUnstable
+}
+
+// load 从数据库加载全部角色权限，并合并父角色的权限。
+// 加载期间发生失效时不保存结果，返回false
+func (cache *PermissionCache) load() (bool, error) {
+	cache.mutex.RLock()
+	generation := cache.generation
+	cache.mutex.RUnlock()
+
+	var rows []struct {
+		RoleID string
+		Code   string
+	}
+	err := database.DB.Model(&models.RolePermission{}).
+		Select("role_permissions.role_id, permissions.code").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id AND permissions.deleted_at IS NULL").
+		Scan(&rows).Error
+	if err != nil {
+		logger.Error("加载角色权限失败: %v", err)
+		return false, err
+	}
+
+	var roles []models.Role
+	if err := database.DB.Find(&roles).Error; err != nil {
+		logger.Error("加载角色失败: %v", err)
+		return false, err
+	}
+
+	direct := make(map[string][]string)
+	for _, row := range rows {
+		direct[row.RoleID] = append(direct[row.RoleID], row.Code)
+	}
+	parents := make(map[string]string, len(roles))
+	for _, role := range roles {
+		parents[role.Name] = role.Parent
+	}
+
+	effective := make(map[string]map[string]bool, len(roles))
+	for _, role := range roles {
+		codes := make(map[string]bool)
+		for _, name := range RoleChain(role.Name, parents) {
+			for _, code := range direct[name] {
+				codes[code] = true
+			}
+		}
+		effective[role.Name] = codes
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.generation != generation {
+		return false, nil
+	}
+	cache.roles = effective
+	cache.parents = parents
+	cache.loaded = true
+	cache.loadedAt = time.Now()
+	logger.Debug("Loaded permissions for %d roles", len(effective))
+	return true, nil
+}
+
+// RoleChain 返回角色及其所有祖先角色，遇到循环继承时停止
+func RoleChain(role string, parents map[string]string) []string {
+	visited := make(map[string]bool)
+	var chain []string
+	for name := role; name != "" && !visited[name]; name = parents[name] {
+		visited[name] = true
+		chain = append(chain, name)
+	}
+	return chain
+}
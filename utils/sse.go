@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ft-backend/common/logger"
+
+	"github.com/gin-contrib/sse"
+)
+
+// NewSSEClient 创建SSE客户端，与WebSocket连接共用管理器的用户和主题路由
+func NewSSEClient(claims *JWTClaims, manager *WebSocketManager) *WebSocketClient {
+	client := NewWebSocketClient(claims, nil, manager)
+	client.closed = make(chan struct{})
+	return client
+}
+
+// SubscribeTopics 校验权限后订阅多个主题，任一主题失败时返回错误
+func (client *WebSocketClient) SubscribeTopics(topics []string) error {
+	for _, topic := range topics {
+		if err := authorizeTopic(client, topic); err != nil {
+			return errors.New(topic + ": " + err.Error())
+		}
+		if err := client.Manager.Subscribe(client, topic); err != nil {
+			return errors.New(topic + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// ServeSSE 向SSE连接推送消息直到请求结束、连接被关闭或令牌到期，退出时注销客户端。
+// lastEventID大于0时先补发之后的通知，补发期间到达的新通知可能重复，客户端按id去重
+func (client *WebSocketClient) ServeSSE(ctx context.Context, w http.ResponseWriter, lastEventID uint64) {
+	defer client.Manager.UnregisterClient(client)
+
+	controller := http.NewResponseController(w)
+	flush := func() error {
+		return controller.Flush()
+	}
+	write := func(data []byte) error {
+		controller.SetWriteDeadline(time.Now().Add(writeWait))
+		return writeSSEMessage(w, data)
+	}
+
+	// 先发出响应头，客户端据此确认连接已建立
+	if err := flush(); err != nil {
+		logger.Error("SSE flush error: %v", err)
+		return
+	}
+
+	if lastEventID > 0 {
+		for {
+			notifications, err := notificationsSince(client.ID, lastEventID, maxReplayBatch)
+			if err != nil {
+				logger.Error("Failed to load notifications for replay: %v", err)
+				return
+			}
+			for _, notification := range notifications {
+				if err := write(MustMarshalJSON(notificationMessage(notification))); err != nil {
+					return
+				}
+				lastEventID = notification.Seq
+			}
+			if err := flush(); err != nil {
+				return
+			}
+			if len(notifications) < maxReplayBatch {
+				break
+			}
+		}
+	}
+
+	ticker := time.NewTicker(client.Manager.pingInterval)
+	defer ticker.Stop()
+
+	var expired <-chan time.Time
+	if !client.ExpiresAt.IsZero() {
+		timer := time.NewTimer(time.Until(client.ExpiresAt))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-client.closed:
+			return
+
+		case <-expired:
+			// 令牌到期后断开，EventSource重连时会因令牌失效被拒绝
+			logger.Info("SSE client %s token expired", client.ID)
+			return
+
+		case <-client.queue.notify:
+			messages, closed := client.queue.drain()
+			for _, message := range messages {
+				if err := write(message.data); err != nil {
+					logger.Debug("SSE write to client %s failed: %v", client.ID, err)
+					return
+				}
+			}
+			if err := flush(); err != nil {
+				return
+			}
+			if closed {
+				return
+			}
+
+		case <-ticker.C:
+			// 注释行作为心跳，防止代理因空闲断开连接
+			controller.SetWriteDeadline(time.Now().Add(writeWait))
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+			if err := flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeSSEMessage 写入一条SSE事件，带序号的通知以序号作为事件ID，供Last-Event-ID续传
+func writeSSEMessage(w io.Writer, data []byte) error {
+	var head struct {
+		Seq uint64 `json:"seq"`
+	}
+	json.Unmarshal(data, &head)
+
+	event := sse.Event{Data: data}
+	if head.Seq > 0 {
+		event.Id = strconv.FormatUint(head.Seq, 10)
+	}
+	return sse.Encode(w, event)
+}
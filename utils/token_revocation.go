@@ -0,0 +1,208 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"ft-backend/common/logger"
+	"ft-backend/database"
+	"ft-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// revocationCheckTTL 未吊销结果的缓存时间。多实例部署时其他实例吊销的令牌最迟在该时间后失效
+const revocationCheckTTL = 10 * time.Second
+
+// GlobalTokenRevocations 全局令牌吊销列表
+var GlobalTokenRevocations *TokenRevocationList
+
+// TokenRevocationList 已吊销令牌的内存索引，持久化在revoked_tokens表中。
+// 内存中没有的令牌查询数据库，以获得其他实例的吊销记录，未吊销的结果短暂缓存。
+// 用户修改或重置密码后，之前签发的令牌全部失效，修改时间取自users.password_changed_at
+type TokenRevocationList struct {
+	mutex     sync.RWMutex
+	tokens    map[string]time.Time     // jti → 令牌过期时间
+	checked   map[string]time.Time     // 确认未吊销的jti → 查询时间
+	passwords map[string]passwordCheck // 用户名 → 最近一次修改密码的时间
+}
+
+// passwordCheck 用户最近一次修改密码的时间及查询时间
+type passwordCheck struct {
+	changedAt time.Time
+	checkedAt time.Time
+}
+
+// NewTokenRevocationList 从数据库加载未过期的吊销记录，并清理已过期的记录
+func NewTokenRevocationList() (*TokenRevocationList, error) {
+	now := time.Now()
+	if err := database.DB.Where("expires_at <= ?", now).Delete(&models.RevokedToken{}).Error; err != nil {
+		return nil, err
+	}
+
+	var revoked []models.RevokedToken
+	if err := database.DB.Where("expires_at > ?", now).Find(&revoked).Error; err != nil {
+		return nil, err
+	}
+
+	list := &TokenRevocationList{
+		tokens:    make(map[string]time.Time, len(revoked)),
+		checked:   make(map[string]time.Time),
+		passwords: make(map[string]passwordCheck),
+	}
+	for _, token := range revoked {
+		list.tokens[token.TokenID] = token.ExpiresAt
+	}
+	return list, nil
+}
+
+// Revoke 吊销令牌，并断开使用该令牌建立的WebSocket连接
+func (list *TokenRevocationList) Revoke(claims *JWTClaims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+
+	record := models.RevokedToken{
+		TokenID:   claims.ID,
+		Username:  claims.Username,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+	if err := database.DB.Where("token_id = ?", claims.ID).FirstOrCreate(&record).Error; err != nil {
+		return err
+	}
+
+	list.mutex.Lock()
+	now := time.Now()
+	for tokenID, expiresAt := range list.tokens {
+		if expiresAt.Before(now) {
+			delete(list.tokens, tokenID)
+		}
+	}
+	list.tokens[claims.ID] = claims.ExpiresAt.Time
+	delete(list.checked, claims.ID)
+	list.mutex.Unlock()
+
+	if GlobalWebSocketManager != nil {
+		GlobalWebSocketManager.DisconnectToken(claims.ID, "token revoked")
+	}
+	return nil
+}
+
+// RevokeUserTokens 用户修改或重置密码后吊销其之前签发的所有令牌，并断开该用户的WebSocket连接。
+// 其他实例在缓存过期后从数据库读取新的修改时间
+func (list *TokenRevocationList) RevokeUserTokens(user *models.User) {
+	if user.PasswordChangedAt == nil {
+		return
+	}
+
+	list.mutex.Lock()
+	list.passwords[user.Username] = passwordCheck{changedAt: *user.PasswordChangedAt, checkedAt: time.Now()}
+	list.mutex.Unlock()
+
+	if GlobalWebSocketManager != nil {
+		GlobalWebSocketManager.DisconnectUser(user.ID, "password changed")
+	}
+}
+
+// Check 检查令牌是否已被吊销或签发于用户最近一次修改密码之前，查询失败时拒绝令牌
+func (list *TokenRevocationList) Check(claims *JWTClaims) error {
+	revoked, err := list.IsRevoked(claims.ID)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	if claims.IssuedAt == nil || claims.Subject == "" {
+		return nil
+	}
+
+	changedAt, err := list.passwordChangedAt(claims.Subject)
+	if err != nil {
+		logger.Error("Failed to check password change of %s: %v", claims.Subject, err)
+		return err
+	}
+	// iat只精确到秒，修改密码后同一秒内签发的新令牌仍然有效
+	if claims.IssuedAt.Time.Before(changedAt.Truncate(time.Second)) {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// passwordChangedAt 查询用户最近一次修改密码的时间，结果缓存revocationCheckTTL
+func (list *TokenRevocationList) passwordChangedAt(username string) (time.Time, error) {
+	list.mutex.RLock()
+	check, ok := list.passwords[username]
+	list.mutex.RUnlock()
+	if ok && time.Since(check.checkedAt) < revocationCheckTTL {
+		return check.changedAt, nil
+	}
+
+	var user models.User
+	err := database.DB.Select("password_changed_at").Where("username = ?", username).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, err
+	}
+
+	now := time.Now()
+	check = passwordCheck{checkedAt: now}
+	if user.PasswordChangedAt != nil {
+		check.changedAt = *user.PasswordChangedAt
+	}
+
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+	if len(list.passwords) >= 10000 {
+		for name, c := range list.passwords {
+			if now.Sub(c.checkedAt) >= revocationCheckTTL {
+				delete(list.passwords, name)
+			}
+		}
+	}
+	list.passwords[username] = check
+	return check.changedAt, nil
+}
+
+// IsRevoked 判断令牌是否已被吊销，内存中没有且缓存过期时查询数据库，查询失败时返回错误
+func (list *TokenRevocationList) IsRevoked(tokenID string) (bool, error) {
+	if tokenID == "" {
+		return false, nil
+	}
+	list.mutex.RLock()
+	_, revoked := list.tokens[tokenID]
+	checkedAt, checked := list.checked[tokenID]
+	list.mutex.RUnlock()
+	if revoked {
+		return true, nil
+	}
+	if checked && time.Since(checkedAt) < revocationCheckTTL {
+		return false, nil
+	}
+
+	now := time.Now()
+	var record models.RevokedToken
+	err := database.DB.Where("token_id = ? AND expires_at > ?", tokenID, now).First(&record).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		// 查询失败时无法确认令牌未被吊销，拒绝令牌且不缓存结果
+		logger.Error("Failed to check token revocation: %v", err)
+		return false, err
+	}
+
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+	if err == nil {
+		list.tokens[tokenID] = record.ExpiresAt
+		delete(list.checked, tokenID)
+		return true, nil
+	}
+	if len(list.checked) >= 10000 {
+		for id, at := range list.checked {
+			if now.Sub(at) >= revocationCheckTTL {
+				delete(list.checked, id)
+			}
+		}
+	}
+	list.checked[tokenID] = now
+	return false, nil
+}
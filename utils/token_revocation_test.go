@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestTokenRevocationCheckPasswordChange(t *testing.T) {
+	changedAt := time.Date(2026, 10, 19, 9, 30, 15, 500_000_000, time.UTC)
+	list := &TokenRevocationList{
+		tokens:  make(map[string]time.Time),
+		checked: make(map[string]time.Time),
+		passwords: map[string]passwordCheck{
+			"alice": {changedAt: changedAt, checkedAt: time.Now()},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		subject  string
+		issuedAt time.Time
+		want     error
+	}{
+		{name: "issued before change", subject: "alice", issuedAt: changedAt.Add(-time.Hour), want: ErrTokenRevoked},
+		{name: "issued the second before change", subject: "alice", issuedAt: changedAt.Add(-time.Second).Truncate(time.Second), want: ErrTokenRevoked},
+		// 修改密码时签发的新令牌iat与修改时间在同一秒
+		{name: "issued in the same second", subject: "alice", issuedAt: changedAt.Truncate(time.Second), want: nil},
+		{name: "issued after change", subject: "alice", issuedAt: changedAt.Add(time.Minute), want: nil},
+	}
+	for _, tt := range tests {
+		claims := &JWTClaims{RegisteredClaims: jwt.RegisteredClaims{
+			Subject:  tt.subject,
+			IssuedAt: jwt.NewNumericDate(tt.issuedAt),
+		}}
+		if err := list.Check(claims); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Check = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestTokenRevocationCheckRevokedTokenID(t *testing.T) {
+	list := &TokenRevocationList{
+		tokens:    map[string]time.Time{"jti-1": time.Now().Add(time.Hour)},
+		checked:   make(map[string]time.Time),
+		passwords: make(map[string]passwordCheck),
+	}
+	if err := list.Check(&JWTClaims{RegisteredClaims: jwt.RegisteredClaims{ID: "jti-1"}}); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Check = %v, want ErrTokenRevoked", err)
+	}
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"time"
+
+	"ft-backend/common/logger"
+	"ft-backend/database"
+	"ft-backend/models"
+)
+
+// StartTopicWatcher 每5秒检查本实例上被订阅的传输记录和集群，updated_at变化后推送给订阅者。
+// 传输记录和集群状态由传输、部署流程直接写入数据库，这里按更新时间检测变化；
+// 每个实例只查询自己的订阅，并只推送给本实例的订阅者，多实例部署时不会重复推送
+func StartTopicWatcher() {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	logger.Info("Topic watcher started")
+
+	// 主题 → 最近一次推送（或首次订阅时）的更新时间
+	seen := make(map[string]time.Time)
+	for range ticker.C {
+		manager := GlobalWebSocketManager
+		if manager == nil {
+			continue
+		}
+		active := make(map[string]bool)
+		watchTransfers(manager, seen, active)
+		watchClusters(manager, seen, active)
+
+		// 清理已无人订阅的主题，重新订阅后从当时的状态开始比较
+		for topic := range seen {
+			if !active[topic] {
+				delete(seen, topic)
+			}
+		}
+	}
+}
+
+// watchTransfers 推送有变化的传输记录
+func watchTransfers(manager *WebSocketManager, seen map[string]time.Time, active map[string]bool) {
+	ids := manager.subscribedIDs(TopicTransferPrefix)
+	if len(ids) == 0 {
+		return
+	}
+
+	var transfers []models.Transfer
+	if err := database.DB.Where("id IN ?", ids).Find(&transfers).Error; err != nil {
+		logger.Error("Failed to get subscribed transfers: %v", err)
+		return
+	}
+	for _, transfer := range transfers {
+		topic := TransferTopic(transfer.ID)
+		active[topic] = true
+		if topicChanged(seen, topic, transfer.UpdatedAt) {
+			manager.publishLocalMessage(topic, WebSocketMessage{
+				Type:    "transfer_update",
+				Message: "Transfer updated",
+				Data:    transfer,
+			})
+		}
+	}
+}
+
+// watchClusters 推送有变化的集群
+func watchClusters(manager *WebSocketManager, seen map[string]time.Time, active map[string]bool) {
+	ids := manager.subscribedIDs(TopicClusterPrefix)
+	if len(ids) == 0 {
+		return
+	}
+
+	var clusters []models.K8sCluster
+	if err := database.DB.Where("id IN ?", ids).Find(&clusters).Error; err != nil {
+		logger.Error("Failed to get subscribed clusters: %v", err)
+		return
+	}
+	for _, cluster := range clusters {
+		topic := ClusterTopic(cluster.ID)
+		active[topic] = true
+		if topicChanged(seen, topic, cluster.UpdatedAt) {
+			manager.publishLocalMessage(topic, WebSocketMessage{
+				Type:    "cluster_update",
+				Message: "Cluster updated",
+				Data:    cluster,
+			})
+		}
+	}
+}
+
+// topicChanged 记录主题对应资源的更新时间，首次看到时只记录不推送，客户端订阅前已通过接口获取当前状态
+func topicChanged(seen map[string]time.Time, topic string, updatedAt time.Time) bool {
+	last, ok := seen[topic]
+	seen[topic] = updatedAt
+	return ok && updatedAt.After(last)
+}
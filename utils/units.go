@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// byteUnits 容量单位，与机器配置中的GB保持一致按1024换算，B、iB后缀可省略
+var byteUnits = map[string]float64{
+	"":  1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+	"t": 1 << 40,
+	"p": 1 << 50,
+}
+
+// ParseByteSize 解析带单位的容量字符串，如 "200GB"、"1.5 TiB"、"512m"、"1,024 MB"，不带单位时视为字节
+func ParseByteSize(value string) (int64, error) {
+	s := strings.ToLower(strings.TrimSpace(value))
+	s = strings.ReplaceAll(s, ",", "")
+	if s == "" {
+		return 0, errors.New("empty size")
+	}
+
+	// 分离数字和单位
+	i := 0
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+		i++
+	}
+	number, unit := s[:i], strings.TrimSpace(s[i:])
+	if number == "" {
+		return 0, errors.New("invalid size: " + value)
+	}
+
+	unit = strings.TrimSuffix(unit, "bytes")
+	unit = strings.TrimSuffix(unit, "byte")
+	unit = strings.TrimSuffix(unit, "b")
+	unit = strings.TrimSuffix(unit, "i")
+	multiplier, ok := byteUnits[unit]
+	if !ok {
+		return 0, errors.New("unknown size unit: " + value)
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, errors.New("invalid size: " + value)
+	}
+	size := n * multiplier
+	// float64(math.MaxInt64) 即 2^63，等于它时转换为int64也会溢出
+	if size >= math.MaxInt64 {
+		return 0, errors.New("size out of range: " + value)
+	}
+	return int64(size), nil
+}
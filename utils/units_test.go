@@ -0,0 +1,57 @@
+package utils
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "100", want: 100},
+		{value: "0", want: 0},
+		{value: "200GB", want: 200 << 30},
+		{value: "200 gb", want: 200 << 30},
+		{value: "1.5 TiB", want: 3 << 39},
+		{value: "512m", want: 512 << 20},
+		{value: "1,024 MB", want: 1 << 30},
+		{value: "0.5k", want: 512},
+		{value: "2 Ki", want: 2 << 10},
+		{value: "10 bytes", want: 10},
+		{value: "1 byte", want: 1},
+		{value: "64B", want: 64},
+		{value: "  3 PB  ", want: 3 << 50},
+		{value: "1.9", want: 1},
+		{value: "8191 PiB", want: 8191 << 50},
+
+		{value: "", wantErr: true},
+		{value: "   ", wantErr: true},
+		{value: "abc", wantErr: true},
+		{value: "GB", wantErr: true},
+		{value: "-5GB", wantErr: true},
+		{value: "5XB", wantErr: true},
+		{value: "5 EB", wantErr: true},
+		{value: "1e3", wantErr: true},
+		{value: "1.2.3 MB", wantErr: true},
+		{value: ".", wantErr: true},
+		{value: "8192 PiB", wantErr: true},
+		{value: "99999999999999999999", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseByteSize(%q) = %d, want error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseByteSize(%q) error: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseByteSize(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
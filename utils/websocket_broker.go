@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"ft-backend/common/config"
+	"ft-backend/common/logger"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 消息代理类型
+const (
+	BrokerMemory = "memory"
+	BrokerRedis  = "redis"
+)
+
+// defaultBrokerChannel Redis发布订阅的默认频道
+const defaultBrokerChannel = "ft:websocket"
+
+// WebSocketBroker WebSocket消息代理，负责在多个后端实例之间分发消息。
+// 每个实例都订阅代理，发布的消息由所有实例（包括发布者自己）投递给本地连接
+type WebSocketBroker interface {
+	Publish(ctx context.Context, payload []byte) error
+	Subscribe(handler func(payload []byte)) error
+	Close() error
+}
+
+// NewWebSocketBroker 根据配置创建消息代理，未配置时使用进程内代理
+func NewWebSocketBroker(cfg config.WebSocketConfig, redisCfg config.RedisConfig) (WebSocketBroker, error) {
+	switch cfg.Broker {
+	case "", BrokerMemory:
+		return NewMemoryBroker(), nil
+	case BrokerRedis:
+		channel := cfg.BrokerChannel
+		if channel == "" {
+			channel = defaultBrokerChannel
+		}
+		return NewRedisBroker(redisCfg, channel)
+	default:
+		return nil, errors.New("unsupported websocket broker: " + cfg.Broker)
+	}
+}
+
+// permissionChannelSuffix 权限缓存失效通知使用的频道后缀
+const permissionChannelSuffix = ":permissions"
+
+// NewPermissionBroker 创建分发权限缓存失效通知的消息代理，与WebSocket消息使用同一Redis的不同频道，
+// 不依赖WebSocket管理器是否初始化
+func NewPermissionBroker(cfg config.WebSocketConfig, redisCfg config.RedisConfig) (WebSocketBroker, error) {
+	if cfg.BrokerChannel == "" {
+		cfg.BrokerChannel = defaultBrokerChannel
+	}
+	cfg.BrokerChannel += permissionChannelSuffix
+	return NewWebSocketBroker(cfg, redisCfg)
+}
+
+// MemoryBroker 进程内消息代理，只适用于单实例部署
+type MemoryBroker struct {
+	handler func(payload []byte)
+	mutex   sync.RWMutex
+}
+
+// NewMemoryBroker 创建进程内消息代理
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+// Publish 直接交给本实例的订阅者处理
+func (broker *MemoryBroker) Publish(ctx context.Context, payload []byte) error {
+	broker.mutex.RLock()
+	handler := broker.handler
+	broker.mutex.RUnlock()
+	if handler != nil {
+		handler(payload)
+	}
+	return nil
+}
+
+// Subscribe 设置消息处理函数
+func (broker *MemoryBroker) Subscribe(handler func(payload []byte)) error {
+	broker.mutex.Lock()
+	broker.handler = handler
+	broker.mutex.Unlock()
+	return nil
+}
+
+// Close 关闭代理
+func (broker *MemoryBroker) Close() error {
+	broker.mutex.Lock()
+	broker.handler = nil
+	broker.mutex.Unlock()
+	return nil
+}
+
+// RedisBroker 基于Redis发布订阅的消息代理，用于多实例部署
+type RedisBroker struct {
+	client  *redis.Client
+	channel string
+	pubsub  *redis.PubSub
+}
+
+// NewRedisBroker 连接Redis并创建消息代理
+func NewRedisBroker(cfg config.RedisConfig, channel string) (*RedisBroker, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     net.JoinHostPort(cfg.Host, cfg.Port),
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &RedisBroker{client: client, channel: channel}, nil
+}
+
+// Publish 发布消息到Redis频道
+func (broker *RedisBroker) Publish(ctx context.Context, payload []byte) error {
+	return broker.client.Publish(ctx, broker.channel, payload).Err()
+}
+
+// Subscribe 订阅Redis频道，连接断开后由客户端自动重连并重新订阅
+func (broker *RedisBroker) Subscribe(handler func(payload []byte)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pubsub := broker.client.Subscribe(ctx, broker.channel)
+	// 等待订阅确认，确保订阅成功后再返回
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return err
+	}
+	broker.pubsub = pubsub
+
+	go func() {
+		for message := range pubsub.Channel() {
+			handler([]byte(message.Payload))
+		}
+		logger.Info("WebSocket broker subscription to %s closed", broker.channel)
+	}()
+	return nil
+}
+
+// Close 取消订阅并关闭Redis连接
+func (broker *RedisBroker) Close() error {
+	if broker.pubsub != nil {
+		broker.pubsub.Close()
+	}
+	return broker.client.Close()
+}
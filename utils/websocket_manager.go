@@ -1,9 +1,14 @@
 package utils
 
 import (
+	"context"
 	"encoding/json"
+	"sort"
+	"strconv"
 	"sync"
+	"time"
 
+	"ft-backend/common/config"
 	"ft-backend/common/logger"
 
 	"github.com/gorilla/websocket"
@@ -12,87 +17,214 @@ import (
 // GlobalWebSocketManager 全局WebSocket管理器
 var GlobalWebSocketManager *WebSocketManager
 
-// WebSocketManager WebSocket连接管理器
+// WebSocketManager WebSocket连接管理器，同一用户可以同时有多个连接（如多个浏览器标签页）。
+// 广播、定向和主题消息经消息代理分发，多实例部署时每个实例只投递给自己持有的连接
 type WebSocketManager struct {
-	clients    map[string]*WebSocketClient
-	register   chan *WebSocketClient
-	unregister chan *WebSocketClient
-	broadcast  chan []byte
-	mutex      sync.Mutex
+	clients   map[string]map[*WebSocketClient]bool // 用户ID → 该用户的连接集合
+	topics    map[string]map[*WebSocketClient]bool // 主题 → 订阅的连接集合
+	broker    WebSocketBroker
+	broadcast chan queuedMessage
+	done      chan struct{}
+	closing   bool
+	mutex     sync.Mutex
+
+	queueSize    int
+	policy       string
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+	shutdownOnce sync.Once
 }
 
-// WebSocketClient WebSocket客户端
+// CloseTokenInvalid 令牌过期或被吊销时的关闭码（4000-4999为应用自定义）
+const CloseTokenInvalid = 4001
+
+// writeWait 单次写入的超时时间
+const writeWait = 10 * time.Second
+
+// WebSocketClient WebSocket客户端，Conn为空时表示SSE连接，两者共用管理器的用户和主题路由
 type WebSocketClient struct {
-	ID      string
-	Conn    *websocket.Conn
-	Manager *WebSocketManager
-	Send    chan []byte
+	ID          string // 用户ID，取自令牌声明
+	Username    string
+	Role        string
+	TokenID     string    // 建立连接所用令牌的jti，令牌吊销时断开连接
+	ExpiresAt   time.Time // 令牌过期时间，到期断开连接
+	ConnectedAt time.Time
+	Conn        *websocket.Conn
+	Manager     *WebSocketManager
+	queue       *sendQueue
+	topics      map[string]bool // 已订阅的主题，由管理器加锁访问
+	closed      chan struct{}   // SSE连接关闭信号
+	closeOnce   sync.Once
 }
 
 // WebSocketMessage WebSocket消息结构
 type WebSocketMessage struct {
 	Type    string      `json:"type"`
+	ID      string      `json:"id,omitempty"`    // 对应客户端请求的ID
+	Seq     uint64      `json:"seq,omitempty"`   // 持久化通知的序号，按用户递增
+	Topic   string      `json:"topic,omitempty"` // 主题消息所属的主题
 	UserID  string      `json:"user_id,omitempty"`
 	FileID  string      `json:"file_id,omitempty"`
 	Data    interface{} `json:"data,omitempty"`
 	Message string      `json:"message,omitempty"`
 }
 
-// NewWebSocketManager 创建新的WebSocket管理器
-func NewWebSocketManager() *WebSocketManager {
-	return &WebSocketManager{
-		clients:    make(map[string]*WebSocketClient),
-		register:   make(chan *WebSocketClient),
-		unregister: make(chan *WebSocketClient),
-		broadcast:  make(chan []byte),
+// 经消息代理分发的消息类型
+const (
+	envelopeBroadcast      = "broadcast"
+	envelopeUser           = "user"
+	envelopeTopic          = "topic"
+	envelopeDisconnect     = "disconnect"
+	envelopeDisconnectUser = "disconnect_user" // 用户修改密码，断开该用户的所有连接
+	envelopeRevalidate     = "revalidate"      // 资源授权变更，各实例重新检查订阅
+)
+
+// brokerEnvelope 经消息代理分发的消息
+type brokerEnvelope struct {
+	Kind   string          `json:"kind"`
+	Target string          `json:"target,omitempty"` // 用户ID、主题或令牌ID
+	Key    string          `json:"key,omitempty"`    // 慢连接队列中合并消息使用的键
+	Reason string          `json:"reason,omitempty"` // 断开连接的原因
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// NewWebSocketManager 创建新的WebSocket管理器并订阅消息代理
+func NewWebSocketManager(cfg config.WebSocketConfig, broker WebSocketBroker) (*WebSocketManager, error) {
+	manager := &WebSocketManager{
+		clients:      make(map[string]map[*WebSocketClient]bool),
+		topics:       make(map[string]map[*WebSocketClient]bool),
+		broker:       broker,
+		broadcast:    make(chan queuedMessage, 64),
+		done:         make(chan struct{}),
+		queueSize:    cfg.SendQueueSize,
+		policy:       cfg.SlowConsumerPolicy,
+		pingInterval: time.Duration(cfg.PingInterval) * time.Second,
+		pongTimeout:  time.Duration(cfg.PongTimeout) * time.Second,
+	}
+	if manager.queueSize <= 0 {
+		manager.queueSize = 256
+	}
+	switch manager.policy {
+	case SlowConsumerDropOldest, SlowConsumerCoalesce, SlowConsumerDisconnect:
+	default:
+		manager.policy = SlowConsumerDisconnect
+	}
+	if manager.pongTimeout <= 0 {
+		manager.pongTimeout = 60 * time.Second
+	}
+	// ping间隔必须小于pong超时，否则连接会在两次ping之间超时
+	if manager.pingInterval <= 0 || manager.pingInterval >= manager.pongTimeout {
+		manager.pingInterval = manager.pongTimeout * 9 / 10
+	}
+	if err := broker.Subscribe(manager.handleBrokerMessage); err != nil {
+		return nil, err
+	}
+	return manager, nil
+}
+
+// dispatch 将消息发布到消息代理，代理不可用时只投递给本实例的连接
+func (manager *WebSocketManager) dispatch(envelope brokerEnvelope) {
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		logger.Error("Failed to marshal broker message: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := manager.broker.Publish(ctx, payload); err != nil {
+		logger.Error("Failed to publish websocket message to broker: %v", err)
+		manager.deliver(envelope)
+	}
+}
+
+// handleBrokerMessage 处理消息代理收到的消息
+func (manager *WebSocketManager) handleBrokerMessage(payload []byte) {
+	var envelope brokerEnvelope
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		logger.Warn("Invalid websocket broker message: %v", err)
+		return
+	}
+	manager.deliver(envelope)
+}
+
+// deliver 将消息投递给本实例持有的连接
+func (manager *WebSocketManager) deliver(envelope brokerEnvelope) {
+	message := queuedMessage{key: envelope.Key, data: envelope.Data}
+	switch envelope.Kind {
+	case envelopeBroadcast:
+		select {
+		case manager.broadcast <- message:
+		case <-manager.done:
+		}
+	case envelopeUser:
+		manager.mutex.Lock()
+		// 用户不在本实例时忽略
+		for client := range manager.clients[envelope.Target] {
+			manager.sendLocked(client, message)
+		}
+		manager.mutex.Unlock()
+	case envelopeTopic:
+		manager.publishLocal(envelope.Target, message)
+	case envelopeDisconnect:
+		manager.disconnectTokenLocal(envelope.Target, envelope.Reason)
+	case envelopeDisconnectUser:
+		manager.disconnectUserLocal(envelope.Target, envelope.Reason)
+	case envelopeRevalidate:
+		go manager.revalidateLocal()
+	default:
+		logger.Warn("Unknown websocket broker message kind: %s", envelope.Kind)
 	}
 }
 
-// Start 启动WebSocket管理器
+// Start 启动WebSocket管理器，Shutdown后退出
 func (manager *WebSocketManager) Start() {
 	for {
 		select {
-		case client := <-manager.register:
-			manager.mutex.Lock()
-			manager.clients[client.ID] = client
-			manager.mutex.Unlock()
-			logger.Info("WebSocket client registered: %s", client.ID)
-
-		case client := <-manager.unregister:
-			manager.mutex.Lock()
-			if _, ok := manager.clients[client.ID]; ok {
-				delete(manager.clients, client.ID)
-				close(client.Send)
-			}
-			manager.mutex.Unlock()
-			logger.Info("WebSocket client unregistered: %s", client.ID)
-
 		case message := <-manager.broadcast:
 			manager.mutex.Lock()
-			for _, client := range manager.clients {
-				select {
-				case client.Send <- message:
-				default:
-					close(client.Send)
-					delete(manager.clients, client.ID)
+			for _, connections := range manager.clients {
+				for client := range connections {
+					manager.sendLocked(client, message)
 				}
 			}
 			manager.mutex.Unlock()
+
+		case <-manager.done:
+			return
 		}
 	}
 }
 
-// RegisterClient 注册客户端
+// RegisterClient 注册客户端，管理器关闭中时直接断开连接
 func (manager *WebSocketManager) RegisterClient(client *WebSocketClient) {
-	manager.register <- client
+	manager.mutex.Lock()
+	if manager.closing {
+		manager.mutex.Unlock()
+		client.queue.close()
+		client.Close(websocket.CloseGoingAway, "server shutting down")
+		return
+	}
+	if manager.clients[client.ID] == nil {
+		manager.clients[client.ID] = make(map[*WebSocketClient]bool)
+	}
+	manager.clients[client.ID][client] = true
+	count := len(manager.clients[client.ID])
+	manager.mutex.Unlock()
+	logger.Info("WebSocket client registered: %s (%d connections)", client.ID, count)
 }
 
-// UnregisterClient 注销客户端
+// UnregisterClient 注销客户端，可以重复调用
 func (manager *WebSocketManager) UnregisterClient(client *WebSocketClient) {
-	manager.unregister <- client
+	manager.mutex.Lock()
+	removed := manager.removeClientLocked(client)
+	manager.mutex.Unlock()
+	if removed {
+		logger.Info("WebSocket client unregistered: %s", client.ID)
+	}
 }
 
-// Broadcast 广播消息
+// Broadcast 向所有实例的所有连接广播消息，同类型的广播消息在慢连接的队列中可以合并
 func (manager *WebSocketManager) Broadcast(message WebSocketMessage) {
 	jsonMessage, err := json.Marshal(message)
 	if err != nil {
@@ -100,46 +232,213 @@ func (manager *WebSocketManager) Broadcast(message WebSocketMessage) {
 		return
 	}
 
-	manager.broadcast <- jsonMessage
+	manager.dispatch(brokerEnvelope{Kind: envelopeBroadcast, Key: "broadcast|" + message.Type, Data: jsonMessage})
 }
 
-// SendToClient 发送消息给特定客户端
-func (manager *WebSocketManager) SendToClient(clientID string, message WebSocketMessage) error {
+// Shutdown 向所有连接发送关闭帧并等待连接退出，超时以ctx为准
+func (manager *WebSocketManager) Shutdown(ctx context.Context) error {
+	manager.shutdownOnce.Do(func() {
+		close(manager.done)
+		if err := manager.broker.Close(); err != nil {
+			logger.Warn("Failed to close websocket broker: %v", err)
+		}
+	})
+
 	manager.mutex.Lock()
-	client, ok := manager.clients[clientID]
+	manager.closing = true
+	var clients []*WebSocketClient
+	for _, connections := range manager.clients {
+		for client := range connections {
+			clients = append(clients, client)
+		}
+	}
 	manager.mutex.Unlock()
 
-	if !ok {
-		return nil // 客户端不存在，忽略
+	logger.Info("Closing %d WebSocket connections", len(clients))
+	for _, client := range clients {
+		go client.Close(websocket.CloseGoingAway, "server shutting down")
 	}
 
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		manager.mutex.Lock()
+		remaining := len(manager.clients)
+		manager.mutex.Unlock()
+		if remaining == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// SendToClient 发送消息给特定用户在所有实例上的连接
+func (manager *WebSocketManager) SendToClient(clientID string, message WebSocketMessage) error {
 	jsonMessage, err := json.Marshal(message)
 	if err != nil {
 		return err
 	}
 
-	client.Send <- jsonMessage
+	manager.dispatch(brokerEnvelope{Kind: envelopeUser, Target: clientID, Data: jsonMessage})
 	return nil
 }
 
-// NewWebSocketClient 创建新的WebSocket客户端
-func NewWebSocketClient(id string, conn *websocket.Conn, manager *WebSocketManager) *WebSocketClient {
-	return &WebSocketClient{
-		ID:      id,
-		Conn:    conn,
-		Manager: manager,
-		Send:    make(chan []byte, 256),
+// sendLocked 将消息放入连接的发送队列，队列已满时按慢消费者策略处理，调用方需持有锁
+func (manager *WebSocketManager) sendLocked(client *WebSocketClient, message queuedMessage) {
+	if client.queue.push(message.key, message.data) {
+		return
+	}
+	logger.Warn("WebSocket client %s send queue full, disconnecting slow consumer", client.ID)
+	manager.removeClientLocked(client)
+	go client.Close(websocket.CloseTryAgainLater, "slow consumer")
+}
+
+// removeClientLocked 移除连接并关闭其发送队列，重复移除时忽略，调用方需持有锁
+func (manager *WebSocketManager) removeClientLocked(client *WebSocketClient) bool {
+	connections, ok := manager.clients[client.ID]
+	if !ok || !connections[client] {
+		return false
+	}
+	delete(connections, client)
+	client.queue.close()
+	for topic := range client.topics {
+		manager.unsubscribeLocked(client, topic)
+	}
+	if len(connections) == 0 {
+		delete(manager.clients, client.ID)
+	}
+	return true
+}
+
+// UserPresence 用户在线信息
+type UserPresence struct {
+	UserID         string    `json:"userId"`
+	Username       string    `json:"username"`
+	Connections    int       `json:"connections"`
+	ConnectedSince time.Time `json:"connectedSince"` // 最早的连接建立时间
+}
+
+// Presence 返回本实例当前在线用户及其连接数，按上线时间排序
+func (manager *WebSocketManager) Presence() []UserPresence {
+	manager.mutex.Lock()
+	presence := make([]UserPresence, 0, len(manager.clients))
+	for userID, connections := range manager.clients {
+		user := UserPresence{UserID: userID, Connections: len(connections)}
+		for client := range connections {
+			user.Username = client.Username
+			if user.ConnectedSince.IsZero() || client.ConnectedAt.Before(user.ConnectedSince) {
+				user.ConnectedSince = client.ConnectedAt
+			}
+		}
+		presence = append(presence, user)
 	}
+	manager.mutex.Unlock()
+
+	sort.Slice(presence, func(i, j int) bool {
+		return presence[i].ConnectedSince.Before(presence[j].ConnectedSince)
+	})
+	return presence
+}
+
+// DisconnectToken 断开所有实例上使用指定令牌建立的连接
+func (manager *WebSocketManager) DisconnectToken(tokenID string, reason string) {
+	manager.dispatch(brokerEnvelope{Kind: envelopeDisconnect, Target: tokenID, Reason: reason})
 }
 
-// ReadPump 从WebSocket连接读取消息
+// disconnectTokenLocal 断开本实例上使用指定令牌建立的连接
+func (manager *WebSocketManager) disconnectTokenLocal(tokenID string, reason string) {
+	manager.mutex.Lock()
+	var clients []*WebSocketClient
+	for _, connections := range manager.clients {
+		for client := range connections {
+			if client.TokenID == tokenID {
+				clients = append(clients, client)
+			}
+		}
+	}
+	manager.mutex.Unlock()
+
+	for _, client := range clients {
+		logger.Info("Disconnecting WebSocket client %s: %s", client.ID, reason)
+		client.Close(CloseTokenInvalid, reason)
+	}
+}
+
+// DisconnectUser 断开所有实例上指定用户的连接
+func (manager *WebSocketManager) DisconnectUser(userID uint, reason string) {
+	manager.dispatch(brokerEnvelope{Kind: envelopeDisconnectUser, Target: strconv.FormatUint(uint64(userID), 10), Reason: reason})
+}
+
+// disconnectUserLocal 断开本实例上指定用户的连接
+func (manager *WebSocketManager) disconnectUserLocal(userID string, reason string) {
+	manager.mutex.Lock()
+	var clients []*WebSocketClient
+	for client := range manager.clients[userID] {
+		clients = append(clients, client)
+	}
+	manager.mutex.Unlock()
+
+	for _, client := range clients {
+		logger.Info("Disconnecting WebSocket client %s: %s", client.ID, reason)
+		client.Close(CloseTokenInvalid, reason)
+	}
+}
+
+// NewWebSocketClient 创建新的WebSocket客户端，客户端身份取自已验证的令牌声明
+func NewWebSocketClient(claims *JWTClaims, conn *websocket.Conn, manager *WebSocketManager) *WebSocketClient {
+	client := &WebSocketClient{
+		ID:          strconv.FormatUint(uint64(claims.UserID), 10),
+		Username:    claims.Username,
+		Role:        claims.Role,
+		TokenID:     claims.ID,
+		ConnectedAt: time.Now(),
+		Conn:        conn,
+		Manager:     manager,
+		queue:       newSendQueue(manager.queueSize, manager.policy),
+		topics:      make(map[string]bool),
+	}
+	if claims.ExpiresAt != nil {
+		client.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return client
+}
+
+// SendMessage 向该连接发送消息
+func (client *WebSocketClient) SendMessage(message WebSocketMessage) {
+	client.queue.push("", MustMarshalJSON(message))
+}
+
+// Close 发送关闭帧后关闭连接，ReadPump随之退出并注销客户端；SSE连接则通知ServeSSE退出
+func (client *WebSocketClient) Close(code int, reason string) {
+	if client.Conn == nil {
+		client.closeOnce.Do(func() {
+			close(client.closed)
+		})
+		return
+	}
+	deadline := time.Now().Add(time.Second)
+	client.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+	client.Conn.Close()
+}
+
+// ReadPump 从WebSocket连接读取消息，超过pong超时没有收到任何数据时断开连接
 func (client *WebSocketClient) ReadPump() {
 	defer func() {
 		client.Manager.UnregisterClient(client)
 		client.Conn.Close()
 	}()
 
+	pongTimeout := client.Manager.pongTimeout
 	client.Conn.SetReadLimit(512) // 限制消息大小
+	client.Conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	client.Conn.SetPongHandler(func(string) error {
+		return client.Conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	})
 
 	for {
 		_, message, err := client.Conn.ReadMessage()
@@ -151,29 +450,56 @@ func (client *WebSocketClient) ReadPump() {
 		}
 
 		// 处理接收到的消息
+		client.Conn.SetReadDeadline(time.Now().Add(pongTimeout))
 		logger.Debug("Received message from client %s: %s", client.ID, message)
+		client.handleMessage(message)
 	}
 }
 
-// WritePump 向WebSocket连接写入消息
+// WritePump 向WebSocket连接写入消息并定期发送ping，令牌到期时断开连接
 func (client *WebSocketClient) WritePump() {
+	ticker := time.NewTicker(client.Manager.pingInterval)
 	defer func() {
+		ticker.Stop()
 		client.Conn.Close()
 	}()
 
+	var expired <-chan time.Time
+	if !client.ExpiresAt.IsZero() {
+		timer := time.NewTimer(time.Until(client.ExpiresAt))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
 	for {
 		select {
-		case message, ok := <-client.Send:
-			if !ok {
-				// 通道已关闭
+		case <-expired:
+			logger.Info("WebSocket client %s token expired", client.ID)
+			client.Close(CloseTokenInvalid, "token expired")
+			return
+
+		case <-client.queue.notify:
+			messages, closed := client.queue.drain()
+			for _, message := range messages {
+				client.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+				if err := client.Conn.WriteMessage(websocket.TextMessage, message.data); err != nil {
+					logger.Error("WebSocket write error: %v", err)
+					return
+				}
+			}
+			if closed {
+				// 队列已关闭
+				client.Conn.SetWriteDeadline(time.Now().Add(writeWait))
 				client.Conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
 
-			if err := client.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				logger.Error("WebSocket write error: %v", err)
+		case <-ticker.C:
+			client.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := client.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				logger.Debug("WebSocket ping to client %s failed: %v", client.ID, err)
 				return
 			}
 		}
 	}
-}
\ No newline at end of file
+}
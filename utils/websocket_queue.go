@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"sync"
+)
+
+// 慢消费者策略：发送队列已满时的处理方式
+const (
+	SlowConsumerDropOldest = "drop_oldest" // 丢弃最早的消息
+	SlowConsumerCoalesce   = "coalesce"    // 用新消息替换队列中同类消息，没有同类消息时丢弃最早的消息
+	SlowConsumerDisconnect = "disconnect"  // 断开连接
+)
+
+// queuedMessage 待发送的消息，key相同的消息可以合并，key为空的消息不合并
+type queuedMessage struct {
+	key  string
+	data []byte
+}
+
+// sendQueue 有界发送队列，关闭后写入被忽略，不会出现向已关闭通道发送的问题
+type sendQueue struct {
+	mutex  sync.Mutex
+	items  []queuedMessage
+	limit  int
+	policy string
+	closed bool
+	notify chan struct{}
+}
+
+// newSendQueue 创建发送队列
+func newSendQueue(limit int, policy string) *sendQueue {
+	return &sendQueue{
+		items:  make([]queuedMessage, 0, limit),
+		limit:  limit,
+		policy: policy,
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// push 写入消息，队列已满时按策略处理，返回false表示应断开连接
+func (q *sendQueue) push(key string, data []byte) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return true
+	}
+
+	if len(q.items) >= q.limit {
+		switch q.policy {
+		case SlowConsumerDisconnect:
+			return false
+		case SlowConsumerCoalesce:
+			if key != "" && q.replace(key, data) {
+				return true
+			}
+			q.items = q.items[1:]
+		default:
+			q.items = q.items[1:]
+		}
+	}
+
+	q.items = append(q.items, queuedMessage{key: key, data: data})
+	q.signal()
+	return true
+}
+
+// replace 替换队列中最近一条同类消息，调用方需持有锁
+func (q *sendQueue) replace(key string, data []byte) bool {
+	for i := len(q.items) - 1; i >= 0; i-- {
+		if q.items[i].key == key {
+			q.items[i].data = data
+			return true
+		}
+	}
+	return false
+}
+
+// drain 取出全部待发送消息，closed表示队列已关闭
+func (q *sendQueue) drain() (items []queuedMessage, closed bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	items = q.items
+	q.items = make([]queuedMessage, 0, q.limit)
+	return items, q.closed
+}
+
+// close 关闭队列，重复关闭时忽略
+func (q *sendQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if !q.closed {
+		q.closed = true
+		q.signal()
+	}
+}
+
+// signal 通知写协程，调用方需持有锁
+func (q *sendQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSendQueuePush(t *testing.T) {
+	type message struct {
+		key  string
+		data string
+	}
+	tests := []struct {
+		name     string
+		policy   string
+		limit    int
+		push     []message
+		wantOK   bool // 最后一次写入的返回值
+		wantData []string
+	}{
+		{
+			name: "below limit", policy: SlowConsumerDisconnect, limit: 3,
+			push:   []message{{"a", "a1"}, {"a", "a2"}},
+			wantOK: true, wantData: []string{"a1", "a2"},
+		},
+		{
+			name: "drop oldest", policy: SlowConsumerDropOldest, limit: 2,
+			push:   []message{{"a", "a1"}, {"b", "b1"}, {"a", "a2"}},
+			wantOK: true, wantData: []string{"b1", "a2"},
+		},
+		{
+			name: "unknown policy drops oldest", policy: "", limit: 2,
+			push:   []message{{"a", "a1"}, {"b", "b1"}, {"c", "c1"}},
+			wantOK: true, wantData: []string{"b1", "c1"},
+		},
+		{
+			name: "coalesce replaces same key in place", policy: SlowConsumerCoalesce, limit: 2,
+			push:   []message{{"a", "a1"}, {"b", "b1"}, {"a", "a2"}},
+			wantOK: true, wantData: []string{"a2", "b1"},
+		},
+		{
+			name: "coalesce replaces the latest same key", policy: SlowConsumerCoalesce, limit: 3,
+			push:   []message{{"a", "a1"}, {"b", "b1"}, {"a", "a2"}, {"a", "a3"}},
+			wantOK: true, wantData: []string{"a1", "b1", "a3"},
+		},
+		{
+			name: "coalesce without same key drops oldest", policy: SlowConsumerCoalesce, limit: 2,
+			push:   []message{{"a", "a1"}, {"b", "b1"}, {"c", "c1"}},
+			wantOK: true, wantData: []string{"b1", "c1"},
+		},
+		{
+			// 空键的增量消息不能合并，否则会丢失队列中尚未发送的其他变化
+			name: "coalesce never merges empty keys", policy: SlowConsumerCoalesce, limit: 2,
+			push:   []message{{"", "d1"}, {"", "d2"}, {"", "d3"}},
+			wantOK: true, wantData: []string{"d2", "d3"},
+		},
+		{
+			name: "disconnect when full", policy: SlowConsumerDisconnect, limit: 2,
+			push:   []message{{"a", "a1"}, {"b", "b1"}, {"a", "a2"}},
+			wantOK: false, wantData: []string{"a1", "b1"},
+		},
+	}
+	for _, tt := range tests {
+		q := newSendQueue(tt.limit, tt.policy)
+		var ok bool
+		for _, m := range tt.push {
+			ok = q.push(m.key, []byte(m.data))
+		}
+		if ok != tt.wantOK {
+			t.Errorf("%s: push = %v, want %v", tt.name, ok, tt.wantOK)
+		}
+
+		items, closed := q.drain()
+		if closed {
+			t.Errorf("%s: queue closed", tt.name)
+		}
+		var data []string
+		for _, item := range items {
+			data = append(data, string(item.data))
+		}
+		if !reflect.DeepEqual(data, tt.wantData) {
+			t.Errorf("%s: queue = %v, want %v", tt.name, data, tt.wantData)
+		}
+	}
+}
+
+func TestSendQueueClosed(t *testing.T) {
+	q := newSendQueue(1, SlowConsumerDisconnect)
+	q.close()
+	q.close()
+
+	if !q.push("a", []byte("a1")) || !q.push("a", []byte("a2")) {
+		t.Error("push after close should be ignored, not disconnect")
+	}
+	items, closed := q.drain()
+	if !closed || len(items) != 0 {
+		t.Errorf("drain = %d items, closed %v; want 0 items, closed", len(items), closed)
+	}
+}
@@ -0,0 +1,342 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"ft-backend/common/logger"
+	"ft-backend/database"
+	"ft-backend/models"
+)
+
+// 客户端消息动作
+const (
+	ActionSubscribe   = "subscribe"
+	ActionUnsubscribe = "unsubscribe"
+	ActionPing        = "ping"
+	ActionReplay      = "replay"
+)
+
+// 主题，带ID的主题格式为 前缀:ID
+const (
+	TopicMachines       = "machines"
+	TopicMachinePrefix  = "machine:"
+	TopicTransferPrefix = "transfer:"
+	TopicClusterPrefix  = "cluster:"
+)
+
+// maxSubscriptionsPerClient 单个连接最多订阅的主题数
+const maxSubscriptionsPerClient = 100
+
+// errPermissionCheckFailed 查询权限失败，重新检查订阅时不据此取消订阅
+var errPermissionCheckFailed = errors.New("permission check failed")
+
+// ClientMessage 客户端发送给服务端的消息
+type ClientMessage struct {
+	ID     string `json:"id"` // 请求ID，原样返回在ack/pong/error中
+	Action string `json:"action"`
+	Topic  string `json:"topic,omitempty"`
+	Since  uint64 `json:"since,omitempty"` // replay时客户端最后收到的通知序号
+}
+
+// handleMessage 处理客户端消息：subscribe/unsubscribe/ping/replay
+func (client *WebSocketClient) handleMessage(data []byte) {
+	var request ClientMessage
+	if err := json.Unmarshal(data, &request); err != nil {
+		client.reply(WebSocketMessage{Type: "error", Message: "invalid message"})
+		return
+	}
+
+	switch request.Action {
+	case ActionPing:
+		client.reply(WebSocketMessage{Type: "pong", ID: request.ID})
+
+	case ActionSubscribe:
+		if err := authorizeTopic(client, request.Topic); err != nil {
+			client.reply(WebSocketMessage{Type: "error", ID: request.ID, Topic: request.Topic, Message: err.Error()})
+			return
+		}
+		if err := client.Manager.Subscribe(client, request.Topic); err != nil {
+			client.reply(WebSocketMessage{Type: "error", ID: request.ID, Topic: request.Topic, Message: err.Error()})
+			return
+		}
+		client.reply(WebSocketMessage{Type: "ack", ID: request.ID, Topic: request.Topic, Message: "subscribed"})
+
+	case ActionUnsubscribe:
+		client.Manager.Unsubscribe(client, request.Topic)
+		client.reply(WebSocketMessage{Type: "ack", ID: request.ID, Topic: request.Topic, Message: "unsubscribed"})
+
+	case ActionReplay:
+		client.replay(request.ID, request.Since)
+
+	default:
+		client.reply(WebSocketMessage{Type: "error", ID: request.ID, Message: "unknown action"})
+	}
+}
+
+// reply 回复客户端请求
+func (client *WebSocketClient) reply(message WebSocketMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		logger.Error("Failed to marshal websocket reply: %v", err)
+		return
+	}
+
+	client.Manager.mutex.Lock()
+	defer client.Manager.mutex.Unlock()
+	if client.Manager.clients[client.ID][client] {
+		client.Manager.sendLocked(client, queuedMessage{data: data})
+	}
+}
+
+// authorizeTopic 检查客户端是否有权订阅主题
+func authorizeTopic(client *WebSocketClient, topic string) error {
+	switch {
+	case topic == TopicMachines:
+		// 完整机器列表只推送给全局拥有查看权限的用户，按资源授权的用户订阅具体机器
+		scope, err := ResolveResourceScope(client.Username, client.Role, ResourceMachine, "machine_view")
+		if err != nil {
+			return errPermissionCheckFailed
+		}
+		if !scope.All {
+			return errors.New("permission denied")
+		}
+		return nil
+
+	case strings.HasPrefix(topic, TopicMachinePrefix):
+		id, err := topicID(topic, TopicMachinePrefix)
+		if err != nil {
+			return err
+		}
+		var machine models.Machine
+		if err := database.DB.First(&machine, id).Error; err != nil {
+			return errors.New("machine not found")
+		}
+		scope, err := ResolveResourceScope(client.Username, client.Role, ResourceMachine, "machine_view")
+		if err != nil {
+			return errPermissionCheckFailed
+		}
+		if !scope.Allows(machine.ID, machine.GroupName) {
+			return errors.New("permission denied")
+		}
+		return nil
+
+	case strings.HasPrefix(topic, TopicClusterPrefix):
+		id, err := topicID(topic, TopicClusterPrefix)
+		if err != nil {
+			return err
+		}
+		var cluster models.K8sCluster
+		if err := database.DB.First(&cluster, id).Error; err != nil {
+			return errors.New("cluster not found")
+		}
+		scope, err := ResolveResourceScope(client.Username, client.Role, ResourceCluster, "k8s_view")
+		if err != nil {
+			return errPermissionCheckFailed
+		}
+		if !scope.Allows(cluster.ID, cluster.GroupName) {
+			return errors.New("permission denied")
+		}
+		return nil
+
+	case strings.HasPrefix(topic, TopicTransferPrefix):
+		// 只能订阅自己的传输记录
+		id, err := topicID(topic, TopicTransferPrefix)
+		if err != nil {
+			return err
+		}
+		allowed, err := GlobalPermissionCache.HasPermission(client.Role, "transfer_view")
+		if err != nil {
+			return errPermissionCheckFailed
+		}
+		var transfer models.Transfer
+		if err := database.DB.First(&transfer, id).Error; err != nil {
+			return errors.New("transfer not found")
+		}
+		if !allowed || strconv.FormatUint(uint64(transfer.UserID), 10) != client.ID {
+			return errors.New("permission denied")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown topic: %s", topic)
+}
+
+// topicID 解析主题中的资源ID
+func topicID(topic, prefix string) (uint, error) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(topic, prefix), 10, 32)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("invalid topic: %s", topic)
+	}
+	return uint(id), nil
+}
+
+// MachineTopic 单台机器的主题
+func MachineTopic(id uint) string {
+	return TopicMachinePrefix + strconv.FormatUint(uint64(id), 10)
+}
+
+// TransferTopic 单条传输记录的主题
+func TransferTopic(id uint) string {
+	return TopicTransferPrefix + strconv.FormatUint(uint64(id), 10)
+}
+
+// ClusterTopic 单个集群的主题
+func ClusterTopic(id uint) string {
+	return TopicClusterPrefix + strconv.FormatUint(uint64(id), 10)
+}
+
+// Subscribe 订阅主题
+func (manager *WebSocketManager) Subscribe(client *WebSocketClient, topic string) error {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	if !manager.clients[client.ID][client] {
+		return errors.New("connection closed")
+	}
+	if client.topics[topic] {
+		return nil
+	}
+	if len(client.topics) >= maxSubscriptionsPerClient {
+		return errors.New("too many subscriptions")
+	}
+
+	if manager.topics[topic] == nil {
+		manager.topics[topic] = make(map[*WebSocketClient]bool)
+	}
+	manager.topics[topic][client] = true
+	client.topics[topic] = true
+	return nil
+}
+
+// Unsubscribe 取消订阅主题
+func (manager *WebSocketManager) Unsubscribe(client *WebSocketClient, topic string) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	manager.unsubscribeLocked(client, topic)
+}
+
+// unsubscribeLocked 取消订阅，调用方需持有锁
+func (manager *WebSocketManager) unsubscribeLocked(client *WebSocketClient, topic string) {
+	delete(client.topics, topic)
+	if subscribers, ok := manager.topics[topic]; ok {
+		delete(subscribers, client)
+		if len(subscribers) == 0 {
+			delete(manager.topics, topic)
+		}
+	}
+}
+
+// HasSubscribers 判断本实例上主题是否有订阅者，发布者可据此跳过无人关注的数据查询
+func (manager *WebSocketManager) HasSubscribers(topic string) bool {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	return len(manager.topics[topic]) > 0
+}
+
+// HasSubscribersWithPrefix 判断是否有以prefix开头的主题被订阅
+func (manager *WebSocketManager) HasSubscribersWithPrefix(prefix string) bool {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	for topic := range manager.topics {
+		if strings.HasPrefix(topic, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// subscribedIDs 返回本实例上以prefix开头的已订阅主题中的资源ID
+func (manager *WebSocketManager) subscribedIDs(prefix string) []uint {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	var ids []uint
+	for topic := range manager.topics {
+		if !strings.HasPrefix(topic, prefix) {
+			continue
+		}
+		if id, err := topicID(topic, prefix); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// RevalidateSubscriptions 通知所有实例重新检查订阅权限，资源授权变更后调用
+func (manager *WebSocketManager) RevalidateSubscriptions() {
+	manager.dispatch(brokerEnvelope{Kind: envelopeRevalidate})
+}
+
+// revalidateLocal 重新检查本实例上所有订阅的权限，取消已无权访问的订阅并通知客户端
+func (manager *WebSocketManager) revalidateLocal() {
+	type subscription struct {
+		client *WebSocketClient
+		topic  string
+	}
+
+	manager.mutex.Lock()
+	var subscriptions []subscription
+	for topic, subscribers := range manager.topics {
+		for client := range subscribers {
+			subscriptions = append(subscriptions, subscription{client: client, topic: topic})
+		}
+	}
+	manager.mutex.Unlock()
+
+	for _, sub := range subscriptions {
+		err := authorizeTopic(sub.client, sub.topic)
+		if err == nil || errors.Is(err, errPermissionCheckFailed) {
+			continue
+		}
+		manager.Unsubscribe(sub.client, sub.topic)
+		sub.client.reply(WebSocketMessage{Type: "unsubscribed", Topic: sub.topic, Message: err.Error()})
+		logger.Info("WebSocket client %s unsubscribed from %s: %v", sub.client.ID, sub.topic, err)
+	}
+}
+
+// publishLocalMessage 将主题消息投递给本实例的订阅者，用于各实例各自检测变化的发布者
+func (manager *WebSocketManager) publishLocalMessage(topic string, message WebSocketMessage) {
+	message.Topic = topic
+	data, err := json.Marshal(message)
+	if err != nil {
+		logger.Error("Failed to marshal topic message: %v", err)
+		return
+	}
+	manager.publishLocal(topic, queuedMessage{key: topic + "|" + message.Type, data: data})
+}
+
+// Publish 向所有实例上主题的订阅者发布消息，同一主题同类型的消息在慢连接的队列中可以合并，
+// 只适用于每条消息都包含完整状态的发布者
+func (manager *WebSocketManager) Publish(topic string, message WebSocketMessage) {
+	manager.publish(topic, message, topic+"|"+message.Type)
+}
+
+// PublishUnkeyed 向所有实例上主题的订阅者发布消息，消息在慢连接的队列中不合并，
+// 用于只包含部分变化的增量消息，避免较新的增量替换掉尚未发送的其他变化
+func (manager *WebSocketManager) PublishUnkeyed(topic string, message WebSocketMessage) {
+	manager.publish(topic, message, "")
+}
+
+// publish 序列化主题消息并分发到所有实例，key为空时不合并
+func (manager *WebSocketManager) publish(topic string, message WebSocketMessage, key string) {
+	message.Topic = topic
+	data, err := json.Marshal(message)
+	if err != nil {
+		logger.Error("Failed to marshal topic message: %v", err)
+		return
+	}
+
+	manager.dispatch(brokerEnvelope{Kind: envelopeTopic, Target: topic, Key: key, Data: data})
+}
+
+// publishLocal 将消息放入本实例订阅者的发送队列
+func (manager *WebSocketManager) publishLocal(topic string, message queuedMessage) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	for client := range manager.topics[topic] {
+		manager.sendLocked(client, message)
+	}
+}